@@ -0,0 +1,482 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	pb "github.com/Jille/raftadmin/proto"
+	"github.com/base-org/leader-election/leader/audit"
+	"github.com/base-org/leader-election/leader/cluster"
+	"github.com/base-org/leader-election/leader/flags"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const (
+	// adminTimeout bounds a whole admin command, including waiting for raft to apply it.
+	adminTimeout = 30 * time.Second
+	// auditPollInterval is how often new audit log entries are fetched with --follow.
+	auditPollInterval = time.Second
+)
+
+// adminCommands talk to a running elector over its gRPC endpoint.
+var adminCommands = []cli.Command{
+	{
+		Name:   "status",
+		Usage:  "Print the raft state, the cluster members and their health",
+		Flags:  flags.AdminFlags,
+		Action: adminAction(showStatus),
+	},
+	{
+		Name:   "leader",
+		Usage:  "Print the current leader",
+		Flags:  flags.AdminFlags,
+		Action: adminAction(showLeader),
+	},
+	{
+		Name:   "transfer",
+		Usage:  "Hand leadership over to another server",
+		Flags:  append([]cli.Flag{flags.TransferTo}, flags.AdminFlags...),
+		Action: adminAction(transferLeadership),
+	},
+	{
+		Name:      "add-voter",
+		Usage:     "Add a server to the cluster as a voter, or promote a non-voter",
+		ArgsUsage: "<id> <address>",
+		Flags:     flags.AdminFlags,
+		Action:    adminAction(addServer(true)),
+	},
+	{
+		Name:      "add-nonvoter",
+		Usage:     "Add a server to the cluster as a non-voter",
+		ArgsUsage: "<id> <address>",
+		Flags:     flags.AdminFlags,
+		Action:    adminAction(addServer(false)),
+	},
+	{
+		Name:      "remove",
+		Usage:     "Remove a server from the cluster",
+		ArgsUsage: "<id>",
+		Flags:     flags.AdminFlags,
+		Action:    adminAction(removeServer),
+	},
+	{
+		Name:   "snapshot",
+		Usage:  "Take a raft snapshot on the queried elector",
+		Flags:  flags.AdminFlags,
+		Action: adminAction(takeSnapshot),
+	},
+	{
+		Name:   "pause-sequencing",
+		Usage:  "Stop the sequencer on the leader and keep it stopped across elections, until resumed",
+		Flags:  append([]cli.Flag{flags.Resume}, flags.AdminFlags...),
+		Action: adminAction(pauseSequencing),
+	},
+	{
+		Name:   "audit",
+		Usage:  "Print the audit log of the queried elector",
+		Flags:  append([]cli.Flag{flags.AuditLimit, flags.AuditFollow}, flags.AdminFlags...),
+		Action: adminAction(tailAudit),
+	},
+}
+
+// adminClient calls the raftadmin and cluster services of an elector.
+type adminClient struct {
+	addr    string
+	conn    *grpc.ClientConn
+	raft    pb.RaftAdminClient
+	cluster *cluster.Client
+}
+
+func dialAdmin(addr string) (*adminClient, error) {
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to dial %s", addr)
+	}
+	return &adminClient{
+		addr:    addr,
+		conn:    conn,
+		raft:    pb.NewRaftAdminClient(conn),
+		cluster: cluster.NewClient(),
+	}, nil
+}
+
+func (a *adminClient) Close() {
+	a.conn.Close()
+	a.cluster.Close()
+}
+
+// leader returns a client of the current leader, which is the only one accepting
+// membership changes. The caller must close it if it is not a.
+func (a *adminClient) leader(ctx context.Context) (*adminClient, error) {
+	resp, err := a.raft.Leader(ctx, &pb.LeaderRequest{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get leader")
+	}
+	if resp.Address == "" {
+		return nil, errors.New("no leader elected")
+	}
+	if resp.Address == a.addr {
+		return a, nil
+	}
+	return dialAdmin(resp.Address)
+}
+
+// await waits for a raft operation started through raftadmin and returns its log index.
+func (a *adminClient) await(ctx context.Context, f *pb.Future, err error) (uint64, error) {
+	if err != nil {
+		return 0, err
+	}
+	resp, err := a.raft.Await(ctx, f)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to wait for operation")
+	}
+	_, _ = a.raft.Forget(ctx, f)
+	if resp.Error != "" {
+		return 0, errors.New(resp.Error)
+	}
+	return resp.Index, nil
+}
+
+// adminAction dials the elector given with --addr and runs the command against it.
+func adminAction(run func(ctx context.Context, c *cli.Context, a *adminClient) error) func(*cli.Context) error {
+	return func(c *cli.Context) error {
+		ctx, cancel := context.WithTimeout(context.Background(), adminTimeout)
+		defer cancel()
+
+		a, err := dialAdmin(c.String(flags.AdminAddr.Name))
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		defer a.Close()
+
+		if err := run(ctx, c, a); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		return nil
+	}
+}
+
+// printResult prints v as JSON with --json, and calls human otherwise.
+func printResult(c *cli.Context, v any, human func()) error {
+	if !c.Bool(flags.JSONOutput.Name) {
+		human()
+		return nil
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+type serverStatus struct {
+	ID       string    `json:"id"`
+	Address  string    `json:"address"`
+	Suffrage string    `json:"suffrage"`
+	Leader   bool      `json:"leader"`
+	Reported bool      `json:"reported"`
+	Healthy  bool      `json:"healthy"`
+	Report   string    `json:"report,omitempty"`
+	Head     uint64    `json:"head"`
+	Received time.Time `json:"receivedAt,omitempty"`
+}
+
+type statusResult struct {
+	Node             string            `json:"node"`
+	State            string            `json:"state"`
+	Leader           string            `json:"leader"`
+	SequencingPaused bool              `json:"sequencingPaused"`
+	Stats            map[string]string `json:"stats"`
+	Servers          []serverStatus    `json:"servers"`
+}
+
+func showStatus(ctx context.Context, c *cli.Context, a *adminClient) error {
+	state, err := a.raft.State(ctx, &pb.StateRequest{})
+	if err != nil {
+		return errors.Wrap(err, "failed to get raft state")
+	}
+	leaderResp, err := a.raft.Leader(ctx, &pb.LeaderRequest{})
+	if err != nil {
+		return errors.Wrap(err, "failed to get leader")
+	}
+	stats, err := a.raft.Stats(ctx, &pb.StatsRequest{})
+	if err != nil {
+		return errors.Wrap(err, "failed to get raft stats")
+	}
+	conf, err := a.raft.GetConfiguration(ctx, &pb.GetConfigurationRequest{})
+	if err != nil {
+		return errors.Wrap(err, "failed to get raft configuration")
+	}
+	health, err := a.cluster.ClusterHealth(ctx, a.addr)
+	if err != nil {
+		return errors.Wrap(err, "failed to get cluster health")
+	}
+
+	peers := make(map[string]cluster.PeerStatus, len(health.Peers))
+	for _, p := range health.Peers {
+		peers[p.ID] = p
+	}
+
+	res := statusResult{
+		Node:             a.addr,
+		State:            strings.ToLower(state.State.String()),
+		Leader:           leaderResp.Address,
+		SequencingPaused: health.SequencingPaused,
+		Stats:            stats.Stats,
+	}
+	for _, srv := range conf.Servers {
+		s := serverStatus{
+			ID:       srv.Id,
+			Address:  srv.Address,
+			Suffrage: strings.ToLower(srv.Suffrage.String()),
+			Leader:   srv.Address == leaderResp.Address,
+		}
+		if p, ok := peers[srv.Id]; ok {
+			s.Reported = true
+			s.Healthy = p.Report.Healthy
+			s.Report = p.Report.String()
+			s.Head = p.Head.Number
+			s.Received = p.ReceivedAt
+		}
+		res.Servers = append(res.Servers, s)
+	}
+
+	return printResult(c, res, func() {
+		fmt.Printf("node:              %s\n", res.Node)
+		fmt.Printf("state:             %s\n", res.State)
+		fmt.Printf("leader:            %s\n", res.Leader)
+		fmt.Printf("term:              %s\n", res.Stats["term"])
+		fmt.Printf("last log index:    %s\n", res.Stats["last_log_index"])
+		fmt.Printf("applied index:     %s\n", res.Stats["applied_index"])
+		fmt.Printf("sequencing paused: %t\n\n", res.SequencingPaused)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tADDRESS\tSUFFRAGE\tLEADER\tHEAD\tHEALTH\tREPORTED")
+		for _, s := range res.Servers {
+			health, reported := "unknown", "never"
+			if s.Reported {
+				health = s.Report
+				reported = time.Since(s.Received).Truncate(time.Second).String() + " ago"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%d\t%s\t%s\n", s.ID, s.Address, s.Suffrage, s.Leader, s.Head, health, reported)
+		}
+		w.Flush()
+	})
+}
+
+type leaderResult struct {
+	ID      string `json:"id"`
+	Address string `json:"address"`
+}
+
+func showLeader(ctx context.Context, c *cli.Context, a *adminClient) error {
+	resp, err := a.raft.Leader(ctx, &pb.LeaderRequest{})
+	if err != nil {
+		return errors.Wrap(err, "failed to get leader")
+	}
+	if resp.Address == "" {
+		return errors.New("no leader elected")
+	}
+	res := leaderResult{Address: resp.Address}
+
+	conf, err := a.raft.GetConfiguration(ctx, &pb.GetConfigurationRequest{})
+	if err != nil {
+		return errors.Wrap(err, "failed to get raft configuration")
+	}
+	for _, srv := range conf.Servers {
+		if srv.Address == resp.Address {
+			res.ID = srv.Id
+		}
+	}
+
+	return printResult(c, res, func() {
+		fmt.Printf("%s %s\n", res.ID, res.Address)
+	})
+}
+
+type operationResult struct {
+	Operation string `json:"operation"`
+	Index     uint64 `json:"index,omitempty"`
+}
+
+func printOperation(c *cli.Context, op string, index uint64) error {
+	return printResult(c, operationResult{Operation: op, Index: index}, func() {
+		if index == 0 {
+			fmt.Printf("%s done\n", op)
+			return
+		}
+		fmt.Printf("%s done at index %d\n", op, index)
+	})
+}
+
+// transferLeadership hands leadership over through the cluster service of the leader, so
+// that the transfer is audited.
+func transferLeadership(ctx context.Context, c *cli.Context, a *adminClient) error {
+	l, err := a.leader(ctx)
+	if err != nil {
+		return err
+	}
+	if l != a {
+		defer l.Close()
+	}
+
+	if err := l.cluster.TransferLeadership(ctx, l.addr, c.String(flags.TransferTo.Name)); err != nil {
+		return errors.Wrap(err, "failed to transfer leadership")
+	}
+	return printOperation(c, "transfer", 0)
+}
+
+func addServer(voter bool) func(ctx context.Context, c *cli.Context, a *adminClient) error {
+	return func(ctx context.Context, c *cli.Context, a *adminClient) error {
+		if c.NArg() != 2 {
+			return errors.New("expected <id> <address>")
+		}
+		id, addr := c.Args().Get(0), c.Args().Get(1)
+
+		l, err := a.leader(ctx)
+		if err != nil {
+			return err
+		}
+		if l != a {
+			defer l.Close()
+		}
+
+		op := "add-nonvoter"
+		var f *pb.Future
+		if voter {
+			op = "add-voter"
+			f, err = l.raft.AddVoter(ctx, &pb.AddVoterRequest{Id: id, Address: addr})
+		} else {
+			f, err = l.raft.AddNonvoter(ctx, &pb.AddNonvoterRequest{Id: id, Address: addr})
+		}
+		index, err := l.await(ctx, f, err)
+		if err != nil {
+			return errors.Wrapf(err, "failed to add %s", id)
+		}
+		return printOperation(c, op, index)
+	}
+}
+
+func removeServer(ctx context.Context, c *cli.Context, a *adminClient) error {
+	if c.NArg() != 1 {
+		return errors.New("expected <id>")
+	}
+	id := c.Args().Get(0)
+
+	l, err := a.leader(ctx)
+	if err != nil {
+		return err
+	}
+	if l != a {
+		defer l.Close()
+	}
+
+	f, err := l.raft.RemoveServer(ctx, &pb.RemoveServerRequest{Id: id})
+	index, err := l.await(ctx, f, err)
+	if err != nil {
+		return errors.Wrapf(err, "failed to remove %s", id)
+	}
+	return printOperation(c, "remove", index)
+}
+
+func takeSnapshot(ctx context.Context, c *cli.Context, a *adminClient) error {
+	f, err := a.raft.Snapshot(ctx, &pb.SnapshotRequest{})
+	index, err := a.await(ctx, f, err)
+	if err != nil {
+		return errors.Wrap(err, "failed to take snapshot")
+	}
+	return printOperation(c, "snapshot", index)
+}
+
+func pauseSequencing(ctx context.Context, c *cli.Context, a *adminClient) error {
+	l, err := a.leader(ctx)
+	if err != nil {
+		return err
+	}
+	if l != a {
+		defer l.Close()
+	}
+
+	paused := !c.Bool(flags.Resume.Name)
+	if err := l.cluster.PauseSequencing(ctx, l.addr, paused); err != nil {
+		return errors.Wrap(err, "failed to pause sequencing")
+	}
+
+	op := "pause-sequencing"
+	if !paused {
+		op = "resume-sequencing"
+	}
+	return printResult(c, operationResult{Operation: op}, func() {
+		fmt.Printf("sequencing paused: %t\n", paused)
+	})
+}
+
+// tailAudit prints the latest audit log entries, one JSON object per line with --json, and
+// keeps polling for new ones with --follow.
+func tailAudit(ctx context.Context, c *cli.Context, a *adminClient) error {
+	entries, err := a.cluster.AuditLog(ctx, a.addr, 0, c.Int(flags.AuditLimit.Name))
+	if err != nil {
+		return errors.Wrap(err, "failed to get audit log")
+	}
+	last := printAudit(c, entries, 0)
+	if !c.Bool(flags.AuditFollow.Name) {
+		return nil
+	}
+
+	// Follow outlives the admin timeout, each poll is bounded on its own.
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ticker := time.NewTicker(auditPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-sigCtx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		pollCtx, cancel := context.WithTimeout(sigCtx, adminTimeout)
+		entries, err := a.cluster.AuditLog(pollCtx, a.addr, last, 0)
+		cancel()
+		if err != nil {
+			if sigCtx.Err() != nil {
+				return nil
+			}
+			return errors.Wrap(err, "failed to get audit log")
+		}
+		last = printAudit(c, entries, last)
+	}
+}
+
+// printAudit prints audit log entries and returns the last sequence number printed.
+func printAudit(c *cli.Context, entries []audit.Entry, last uint64) uint64 {
+	enc := json.NewEncoder(os.Stdout)
+	for _, e := range entries {
+		last = e.Seq
+		if c.Bool(flags.JSONOutput.Name) {
+			_ = enc.Encode(e)
+			continue
+		}
+		params := make([]string, 0, len(e.Params))
+		for k, v := range e.Params {
+			params = append(params, k+"="+v)
+		}
+		sort.Strings(params)
+		fields := []string{e.Time.Format(time.RFC3339Nano), strconv.FormatUint(e.Seq, 10), "term=" + strconv.FormatUint(e.Term, 10), e.Event, "reason=" + e.Reason}
+		fields = append(fields, params...)
+		if e.Result != "" {
+			fields = append(fields, "result="+strconv.Quote(e.Result))
+		}
+		fmt.Println(strings.Join(fields, " "))
+	}
+	return last
+}
@@ -4,15 +4,23 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
+	"time"
 
 	"github.com/base-org/leader-election/leader"
 	"github.com/base-org/leader-election/leader/config"
 	"github.com/base-org/leader-election/leader/flags"
+	"github.com/base-org/leader-election/leader/rpc"
+	"github.com/base-org/leader-election/leader/tracing"
 	"github.com/hashicorp/raft"
 	"github.com/urfave/cli"
 )
 
+// tracingShutdownTimeout bounds flushing the spans left when the elector exits.
+const tracingShutdownTimeout = 5 * time.Second
+
 func main() {
 	app := cli.NewApp()
 	app.Version = "0.0.1"
@@ -21,6 +29,17 @@ func main() {
 	app.Usage = "Sequencer Leader Election Service"
 	app.Description = "A service that uses Raft to elect a leader for a sequencer"
 	app.Action = LeaderElectorMain
+	app.Commands = append(adminCommands, cli.Command{
+		Name:  "config",
+		Usage: "Inspect the configuration",
+		Subcommands: []cli.Command{
+			{
+				Name:   "check",
+				Usage:  "Validate the configuration from the global flags, env vars and --config, and report all problems",
+				Action: ConfigCheck,
+			},
+		},
+	})
 
 	if err := app.Run(os.Args); err != nil {
 		panic(err)
@@ -30,40 +49,132 @@ func main() {
 func LeaderElectorMain(ctx *cli.Context) error {
 	cfg, err := ReadConfig(ctx)
 	if err != nil {
-		return err
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(sigCtx, cfg.Tracing, string(cfg.RaftConfig.LocalID))
+	if err != nil {
+		cfg.Logger.Error("failed to set up tracing", "err", err)
+		return cli.NewExitError("", 1)
 	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			cfg.Logger.Warn("failed to flush traces", "err", err)
+		}
+	}()
 
-	le, err := leader.NewElector(context.Background(), cfg)
+	le, err := leader.NewElector(sigCtx, cfg)
 	if err != nil {
-		return err
+		cfg.Logger.Error("failed to create elector", "err", err)
+		return cli.NewExitError("", 1)
 	}
 
-	le.Run(context.Background())
+	if err := le.Run(sigCtx); err != nil {
+		cfg.Logger.Error("elector stopped", "err", err)
+		return cli.NewExitError("", 1)
+	}
+	return nil
+}
+
+// ConfigCheck validates the configuration without starting the elector. The configuration
+// is read from the global flags, e.g. leader-elector --config leader.toml config check.
+func ConfigCheck(ctx *cli.Context) error {
+	for ctx.Parent() != nil {
+		ctx = ctx.Parent()
+	}
+	if _, err := ReadConfig(ctx); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	fmt.Println("configuration is valid")
 	return nil
 }
 
+// ReadConfig builds the configuration from the flags, env vars and config file, and
+// validates it.
 func ReadConfig(ctx *cli.Context) (*config.Config, error) {
-	if err := flags.CheckRequired(ctx); err != nil {
+	if err := flags.ApplyConfigFile(ctx); err != nil {
 		return nil, err
 	}
 
 	rc := raft.DefaultConfig()
 	rc.LocalID = raft.ServerID(ctx.String(flags.ServerID.Name))
+	rc.HeartbeatTimeout = ctx.Duration(flags.RaftHeartbeatTimeout.Name)
+	rc.ElectionTimeout = ctx.Duration(flags.RaftElectionTimeout.Name)
+	rc.CommitTimeout = ctx.Duration(flags.RaftCommitTimeout.Name)
+	rc.LeaderLeaseTimeout = ctx.Duration(flags.LeaderLeaseTimeout.Name)
+	rc.SnapshotInterval = ctx.Duration(flags.RaftSnapshotInterval.Name)
+	rc.SnapshotThreshold = ctx.Uint64(flags.RaftSnapshotThreshold.Name)
+	rc.TrailingLogs = ctx.Uint64(flags.RaftTrailingLogs.Name)
+	rc.MaxAppendEntries = ctx.Int(flags.RaftMaxAppendEntries.Name)
 
-	fmt.Printf("GethAddr is: %s", ctx.String(flags.OpGethAddr.Name))
+	storageDir := ctx.String(flags.StorageDir.Name)
+	if storageDir != "" {
+		storageDir = filepath.Join(storageDir, ctx.String(flags.ServerID.Name))
+	}
+
+	rpcTimeouts, err := rpc.ParseTimeouts(ctx.Duration(flags.RPCTimeout.Name), ctx.StringSlice(flags.RPCMethodTimeouts.Name))
+	if err != nil {
+		return nil, err
+	}
 
 	cfg := &config.Config{
 		RaftConfig:      rc,
 		ServerAddr:      ctx.String(flags.ServerAddr.Name),
-		StorageDir:      filepath.Join(ctx.String(flags.StorageDir.Name), ctx.String(flags.ServerID.Name)),
+		StorageDir:      storageDir,
 		SnapshotLimit:   ctx.Int(flags.SnapshotLimit.Name),
 		Bootstrap:       ctx.Bool(flags.Bootstrap.Name),
 		NodeAddr:        ctx.String(flags.OpNodeAddr.Name),
 		BatcherAddr:     ctx.String(flags.OpBatcherAddr.Name),
 		GethAddr:        ctx.String(flags.OpGethAddr.Name),
+		RPCTimeouts:     rpcTimeouts,
+		CatchUpTimeout:  ctx.Duration(flags.CatchUpTimeout.Name),
+		ShutdownTimeout: ctx.Duration(flags.ShutdownTimeout.Name),
+		Health: config.HealthConfig{
+			Interval:            ctx.Duration(flags.HealthInterval.Name),
+			UnsafeStallTimeout:  ctx.Duration(flags.HealthUnsafeStallTimeout.Name),
+			MaxL1OriginLag:      ctx.Uint64(flags.HealthMaxL1OriginLag.Name),
+			MinPeers:            ctx.Uint64(flags.HealthMinPeers.Name),
+			MaxBlockAge:         ctx.Duration(flags.HealthMaxBlockAge.Name),
+			FailureThreshold:    ctx.Int(flags.HealthFailureThreshold.Name),
+			SuccessThreshold:    ctx.Int(flags.HealthSuccessThreshold.Name),
+			GracePeriod:         ctx.Duration(flags.HealthGracePeriod.Name),
+			MinTransferInterval: ctx.Duration(flags.HealthMinTransferInterval.Name),
+			MinVoters:           ctx.Int(flags.HealthMinVoters.Name),
+		},
+		Audit: config.AuditConfig{
+			MaxSize:    int64(ctx.Int(flags.AuditMaxSize.Name)) << 20,
+			MaxBackups: ctx.Int(flags.AuditMaxBackups.Name),
+		},
+		Metrics: config.MetricsConfig{
+			Enabled: ctx.Bool(flags.MetricsEnabled.Name),
+			Addr:    ctx.String(flags.MetricsAddr.Name),
+		},
+		Status: config.StatusConfig{
+			Enabled: ctx.Bool(flags.StatusEnabled.Name),
+			Addr:    ctx.String(flags.StatusAddr.Name),
+		},
+		Tracing: config.TracingConfig{
+			Exporter:    ctx.String(flags.TracingExporter.Name),
+			Endpoint:    ctx.String(flags.TracingEndpoint.Name),
+			SampleRatio: ctx.Float64(flags.TracingSampleRatio.Name),
+		},
+		Log: config.LogConfig{
+			Level:  ctx.String(flags.LogLevel.Name),
+			Format: ctx.String(flags.LogFormat.Name),
+		},
 		Test:            ctx.Bool(flags.Test.Name),
 		HealthCheckPath: ctx.String(flags.HealthCheckPath.Name),
 	}
 
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	cfg.Logger = cfg.Log.NewLogger(string(rc.LocalID))
+	rc.Logger = cfg.Logger.Named("raft")
 	return cfg, nil
 }
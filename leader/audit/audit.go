@@ -0,0 +1,301 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pkg/errors"
+)
+
+// FileName is the name of the audit log in the storage directory, rotated files get a
+// numbered suffix, the lowest being the most recent.
+const FileName = "audit.log"
+
+// Events recorded in the audit log.
+const (
+	EventLeadership     = "leadership"
+	EventTransition     = "transition"
+	EventTransfer       = "leadership-transfer"
+	EventPause          = "pause-sequencing"
+	EventStartSequencer = "start-sequencer"
+	EventStopSequencer  = "stop-sequencer"
+	EventStartBatcher   = "start-batcher"
+	EventStopBatcher    = "stop-batcher"
+)
+
+// Reasons an event happened.
+const (
+	// ReasonElection is a change of the raft leadership.
+	ReasonElection = "election"
+	// ReasonReconcile is the reconciliation loop fixing the sequencer status.
+	ReasonReconcile = "reconcile"
+	// ReasonHealth is a health check failing.
+	ReasonHealth = "health"
+	// ReasonOperator is an operator command.
+	ReasonOperator = "operator"
+	// ReasonShutdown is the elector exiting.
+	ReasonShutdown = "shutdown"
+	// ReasonLease is the leader lease staying expired.
+	ReasonLease = "lease"
+)
+
+// ResultOK is the result of an event that succeeded.
+const ResultOK = "ok"
+
+// Entry is a line of the audit log.
+type Entry struct {
+	// Seq increases by one with every entry written by the node, across restarts.
+	Seq    uint64            `json:"seq"`
+	Time   time.Time         `json:"time"`
+	Node   string            `json:"node"`
+	Term   uint64            `json:"term"`
+	Event  string            `json:"event"`
+	Reason string            `json:"reason,omitempty"`
+	Params map[string]string `json:"params,omitempty"`
+	// Result is ResultOK or the error returned, if any.
+	Result string `json:"result,omitempty"`
+}
+
+// Result returns the result recorded for err.
+func Result(err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return ResultOK
+}
+
+// Log is an append-only audit log of JSON lines, rotated once it grows over a maximum
+// size. It is safe for concurrent use, and so is a nil *Log, which records nothing.
+type Log struct {
+	log        hclog.Logger
+	dir        string
+	node       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+	seq  uint64
+}
+
+// Open opens the audit log in dir, creating it if needed. It is rotated once it is over
+// maxSize bytes, keeping maxBackups rotated files.
+func Open(dir, node string, maxSize int64, maxBackups int, log hclog.Logger) (*Log, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrap(err, "failed to create audit log dir")
+	}
+	l := &Log{
+		log:        log,
+		dir:        dir,
+		node:       node,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+	last, err := l.lastEntry()
+	if err != nil {
+		return nil, err
+	}
+	l.seq = last.Seq
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Record appends an entry, filling in its sequence number, time and node. Failures are
+// logged, auditing never blocks the elector.
+func (l *Log) Record(e Entry) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.seq++
+	e.Seq = l.seq
+	e.Time = time.Now().UTC()
+	e.Node = l.node
+	if err := l.write(e); err != nil {
+		l.log.Error("failed to write audit log", "event", e.Event, "err", err)
+	}
+}
+
+// Tail returns up to limit of the latest entries with a sequence number above after,
+// oldest first.
+func (l *Log) Tail(after uint64, limit int) ([]Entry, error) {
+	if l == nil {
+		return nil, nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var entries []Entry
+	// Walk from the current file to the oldest rotated one, until enough entries are found.
+	for i := 0; i <= l.maxBackups; i++ {
+		found, err := readEntries(l.path(i))
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var newer []Entry
+		for _, e := range found {
+			if e.Seq > after {
+				newer = append(newer, e)
+			}
+		}
+		entries = append(newer, entries...)
+		if len(entries) >= limit || len(newer) < len(found) {
+			break
+		}
+	}
+	if len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	return entries, nil
+}
+
+// Close closes the audit log.
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+func (l *Log) write(e Entry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode audit entry")
+	}
+	line = append(line, '\n')
+
+	if l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		return errors.Wrap(err, "failed to append audit entry")
+	}
+	return l.file.Sync()
+}
+
+// rotate shifts every rotated file by one, dropping the oldest, and starts a new file.
+func (l *Log) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return errors.Wrap(err, "failed to close audit log")
+	}
+	err := l.shift()
+	// Keep appending to the current file if it could not be rotated.
+	if oerr := l.open(); oerr != nil {
+		return oerr
+	}
+	return err
+}
+
+func (l *Log) shift() error {
+	if err := os.Remove(l.path(l.maxBackups)); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "failed to remove oldest audit log")
+	}
+	for i := l.maxBackups - 1; i >= 0; i-- {
+		if err := os.Rename(l.path(i), l.path(i+1)); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "failed to rotate audit log")
+		}
+	}
+	return nil
+}
+
+func (l *Log) open() error {
+	f, err := os.OpenFile(l.path(0), os.O_RDWR|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return errors.Wrap(err, "failed to open audit log")
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return errors.Wrap(err, "failed to stat audit log")
+	}
+	l.file = f
+	l.size = info.Size()
+
+	// Terminate a line truncated by a crash, so that the next entry starts on its own line.
+	if l.size > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, l.size-1); err != nil {
+			f.Close()
+			return errors.Wrap(err, "failed to read audit log")
+		}
+		if last[0] != '\n' {
+			n, err := f.Write([]byte{'\n'})
+			l.size += int64(n)
+			if err != nil {
+				f.Close()
+				return errors.Wrap(err, "failed to repair audit log")
+			}
+		}
+	}
+	return nil
+}
+
+// lastEntry returns the last entry written, from the current file or the most recent
+// rotated one if it is empty.
+func (l *Log) lastEntry() (Entry, error) {
+	for i := 0; i <= 1; i++ {
+		entries, err := readEntries(l.path(i))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return Entry{}, err
+		}
+		if len(entries) > 0 {
+			return entries[len(entries)-1], nil
+		}
+	}
+	return Entry{}, nil
+}
+
+func (l *Log) path(i int) string {
+	if i == 0 {
+		return filepath.Join(l.dir, FileName)
+	}
+	return filepath.Join(l.dir, fmt.Sprintf("%s.%d", FileName, i))
+}
+
+// readEntries decodes every entry of an audit log file. A truncated last line, left by a
+// crash while writing, is skipped.
+func readEntries(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", path)
+	}
+	return entries, nil
+}
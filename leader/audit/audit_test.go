@@ -0,0 +1,183 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+func openLog(t *testing.T, dir string, maxSize int64, maxBackups int) *Log {
+	t.Helper()
+	l, err := Open(dir, "node-1", maxSize, maxBackups, hclog.NewNullLogger())
+	if err != nil {
+		t.Fatalf("Open() = %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+func record(l *Log, n int) {
+	for i := 0; i < n; i++ {
+		l.Record(Entry{Term: 1, Event: EventTransition})
+	}
+}
+
+func seqs(entries []Entry) []uint64 {
+	s := make([]uint64, 0, len(entries))
+	for _, e := range entries {
+		s = append(s, e.Seq)
+	}
+	return s
+}
+
+func equal(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestTail(t *testing.T) {
+	l := openLog(t, t.TempDir(), 1<<20, 1)
+	record(l, 5)
+
+	tests := []struct {
+		name  string
+		after uint64
+		limit int
+		want  []uint64
+	}{
+		{name: "all", limit: 10, want: []uint64{1, 2, 3, 4, 5}},
+		{name: "latest first limited", limit: 2, want: []uint64{4, 5}},
+		{name: "after", after: 3, limit: 10, want: []uint64{4, 5}},
+		{name: "nothing newer", after: 5, limit: 10, want: []uint64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := l.Tail(tt.after, tt.limit)
+			if err != nil {
+				t.Fatalf("Tail() = %v", err)
+			}
+			if got := seqs(entries); !equal(got, tt.want) {
+				t.Errorf("Tail() = %v, want %v", got, tt.want)
+			}
+			for _, e := range entries {
+				if e.Node != "node-1" || e.Time.IsZero() {
+					t.Errorf("Tail() entry %d has node %q and time %s", e.Seq, e.Node, e.Time)
+				}
+			}
+		})
+	}
+}
+
+func TestRotation(t *testing.T) {
+	dir := t.TempDir()
+	// Every entry is over the maximum size, so each one starts a new file.
+	l := openLog(t, dir, 1, 2)
+	record(l, 5)
+
+	for i, name := range []string{FileName, FileName + ".1", FileName + ".2"} {
+		entries, err := readEntries(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", name, err)
+		}
+		if got, want := seqs(entries), []uint64{uint64(5 - i)}; !equal(got, want) {
+			t.Errorf("%s holds %v, want %v", name, got, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, FileName+".3")); !os.IsNotExist(err) {
+		t.Errorf("%s.3 exists, want only 2 backups", FileName)
+	}
+
+	// Tail reads across rotated files, and only finds what was kept.
+	entries, err := l.Tail(0, 10)
+	if err != nil {
+		t.Fatalf("Tail() = %v", err)
+	}
+	if got, want := seqs(entries), []uint64{3, 4, 5}; !equal(got, want) {
+		t.Errorf("Tail() = %v, want %v", got, want)
+	}
+}
+
+func TestSeqContinuesAcrossRestarts(t *testing.T) {
+	dir := t.TempDir()
+	l := openLog(t, dir, 1<<20, 1)
+	record(l, 3)
+	l.Close()
+
+	l = openLog(t, dir, 1<<20, 1)
+	record(l, 1)
+	entries, err := l.Tail(0, 10)
+	if err != nil {
+		t.Fatalf("Tail() = %v", err)
+	}
+	if got, want := seqs(entries), []uint64{1, 2, 3, 4}; !equal(got, want) {
+		t.Errorf("Tail() = %v, want %v", got, want)
+	}
+}
+
+func TestSeqContinuesFromRotatedFile(t *testing.T) {
+	dir := t.TempDir()
+	l := openLog(t, dir, 1<<20, 1)
+	record(l, 2)
+	l.Close()
+	// A crash right after rotating leaves an empty current file.
+	if err := os.Rename(filepath.Join(dir, FileName), filepath.Join(dir, FileName+".1")); err != nil {
+		t.Fatalf("failed to rotate: %v", err)
+	}
+
+	l = openLog(t, dir, 1<<20, 1)
+	record(l, 1)
+	entries, err := l.Tail(2, 10)
+	if err != nil {
+		t.Fatalf("Tail() = %v", err)
+	}
+	if got, want := seqs(entries), []uint64{3}; !equal(got, want) {
+		t.Errorf("Tail() = %v, want %v", got, want)
+	}
+}
+
+func TestTruncatedLineIsRepaired(t *testing.T) {
+	dir := t.TempDir()
+	l := openLog(t, dir, 1<<20, 1)
+	record(l, 2)
+	l.Close()
+
+	// A crash while writing leaves a truncated last line.
+	f, err := os.OpenFile(filepath.Join(dir, FileName), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("failed to open audit log: %v", err)
+	}
+	if _, err := f.WriteString(`{"seq":3,"ti`); err != nil {
+		t.Fatalf("failed to truncate audit log: %v", err)
+	}
+	f.Close()
+
+	l = openLog(t, dir, 1<<20, 1)
+	record(l, 1)
+	entries, err := l.Tail(0, 10)
+	if err != nil {
+		t.Fatalf("Tail() = %v", err)
+	}
+	if got, want := seqs(entries), []uint64{1, 2, 3}; !equal(got, want) {
+		t.Errorf("Tail() = %v, want %v", got, want)
+	}
+}
+
+func TestNilLog(t *testing.T) {
+	var l *Log
+	l.Record(Entry{Event: EventTransition})
+	if entries, err := l.Tail(0, 10); entries != nil || err != nil {
+		t.Errorf("Tail() = %v, %v, want nil, nil", entries, err)
+	}
+	if err := l.Close(); err != nil {
+		t.Errorf("Close() = %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package cluster
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	lh "github.com/base-org/leader-election/leader/health"
+	"github.com/base-org/leader-election/leader/rpc"
+)
+
+// PeerStatus is the latest health reported by a node of the cluster.
+type PeerStatus struct {
+	ID      string          `json:"id"`
+	Address string          `json:"address"`
+	Report  lh.HealthReport `json:"report"`
+	// Head is the latest block of the node's op-geth.
+	Head rpc.BlockID `json:"head"`
+	// ReceivedAt is when the status was received, according to the local clock.
+	ReceivedAt time.Time `json:"receivedAt"`
+}
+
+// Registry holds the latest status of each node. It is safe for concurrent use.
+type Registry struct {
+	mu    sync.RWMutex
+	peers map[string]PeerStatus
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		peers: make(map[string]PeerStatus),
+	}
+}
+
+// Update records the status of a node, replacing its previous one.
+func (r *Registry) Update(status PeerStatus) {
+	status.ReceivedAt = time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.peers[status.ID] = status
+}
+
+// Get returns the latest status of a node if it was received within maxAge.
+func (r *Registry) Get(id string, maxAge time.Duration) (PeerStatus, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	status, ok := r.peers[id]
+	if !ok || time.Since(status.ReceivedAt) > maxAge {
+		return PeerStatus{}, false
+	}
+	return status, true
+}
+
+// All returns the latest status of every node, sorted by ID.
+func (r *Registry) All() []PeerStatus {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	statuses := make([]PeerStatus, 0, len(r.peers))
+	for _, s := range r.peers {
+		statuses = append(statuses, s)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].ID < statuses[j].ID
+	})
+	return statuses
+}
@@ -0,0 +1,426 @@
+package cluster
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/base-org/leader-election/leader/audit"
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/peer"
+)
+
+const (
+	serviceName         = "leader.Cluster"
+	reportHealthMethod  = "/" + serviceName + "/ReportHealth"
+	clusterHealthMethod = "/" + serviceName + "/ClusterHealth"
+	pauseMethod         = "/" + serviceName + "/PauseSequencing"
+	transferMethod      = "/" + serviceName + "/TransferLeadership"
+	auditLogMethod      = "/" + serviceName + "/AuditLog"
+)
+
+// maxAuditEntries bounds the audit log entries returned by a single call.
+const maxAuditEntries = 1000
+
+// Empty is the request or response of calls without parameters or results.
+type Empty struct{}
+
+// ClusterHealth is the latest status of every node known to the queried node.
+type ClusterHealth struct {
+	Peers            []PeerStatus `json:"peers"`
+	SequencingPaused bool         `json:"sequencingPaused"`
+}
+
+// PauseRequest pauses or resumes sequencing.
+type PauseRequest struct {
+	Paused bool `json:"paused"`
+}
+
+// TransferRequest hands leadership over.
+type TransferRequest struct {
+	// To is the ID of the server to hand leadership to, the healthiest peer if empty.
+	To string `json:"to"`
+}
+
+// AuditRequest asks for the latest audit log entries of a node.
+type AuditRequest struct {
+	// After only returns the entries with a greater sequence number.
+	After uint64 `json:"after"`
+	// Limit is the maximum number of entries returned.
+	Limit int `json:"limit"`
+}
+
+// AuditResponse holds audit log entries, oldest first.
+type AuditResponse struct {
+	Entries []audit.Entry `json:"entries"`
+}
+
+// ClusterServer is the gRPC service electors use to share their health with each other,
+// and operators use to get a cluster-wide view of it, to pause sequencing and to hand
+// leadership over.
+type ClusterServer interface {
+	// ReportHealth records the status of the calling node.
+	ReportHealth(ctx context.Context, status *PeerStatus) (*Empty, error)
+	// ClusterHealth returns the latest status of every node.
+	ClusterHealth(ctx context.Context, req *Empty) (*ClusterHealth, error)
+	// PauseSequencing pauses or resumes sequencing cluster-wide, it must be sent to the leader.
+	PauseSequencing(ctx context.Context, req *PauseRequest) (*Empty, error)
+	// TransferLeadership hands leadership over, it must be sent to the leader.
+	TransferLeadership(ctx context.Context, req *TransferRequest) (*Empty, error)
+	// AuditLog returns the latest entries of the audit log of the queried node.
+	AuditLog(ctx context.Context, req *AuditRequest) (*AuditResponse, error)
+}
+
+// Members returns the servers of the raft configuration, the only nodes allowed to report
+// their health.
+type Members interface {
+	Servers() ([]raft.Server, error)
+}
+
+// Sequencing controls whether the cluster leader runs the sequencer.
+type Sequencing interface {
+	SequencingPaused() bool
+	SetSequencingPaused(paused bool) error
+}
+
+// Leadership hands the cluster leadership over.
+type Leadership interface {
+	TransferLeadership(ctx context.Context, to string) error
+}
+
+// AuditLog reads the audit log of the local node.
+type AuditLog interface {
+	Tail(after uint64, limit int) ([]audit.Entry, error)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*ClusterServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ReportHealth",
+			Handler:    reportHealthHandler,
+		},
+		{
+			MethodName: "ClusterHealth",
+			Handler:    clusterHealthHandler,
+		},
+		{
+			MethodName: "PauseSequencing",
+			Handler:    pauseHandler,
+		},
+		{
+			MethodName: "TransferLeadership",
+			Handler:    transferHandler,
+		},
+		{
+			MethodName: "AuditLog",
+			Handler:    auditLogHandler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "leader/cluster/service.go",
+}
+
+func reportHealthHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(PeerStatus)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).ReportHealth(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: reportHealthMethod,
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(ClusterServer).ReportHealth(ctx, req.(*PeerStatus))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func clusterHealthHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).ClusterHealth(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: clusterHealthMethod,
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(ClusterServer).ClusterHealth(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func pauseHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(PauseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).PauseSequencing(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: pauseMethod,
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(ClusterServer).PauseSequencing(ctx, req.(*PauseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func transferHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(TransferRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).TransferLeadership(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: transferMethod,
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(ClusterServer).TransferLeadership(ctx, req.(*TransferRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func auditLogHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(AuditRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClusterServer).AuditLog(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: auditLogMethod,
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(ClusterServer).AuditLog(ctx, req.(*AuditRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Server implements ClusterServer on top of a Registry.
+type Server struct {
+	registry   *Registry
+	members    Members
+	sequencing Sequencing
+	leadership Leadership
+	auditLog   AuditLog
+}
+
+var _ ClusterServer = (*Server)(nil)
+
+func NewServer(registry *Registry, members Members, sequencing Sequencing, leadership Leadership, auditLog AuditLog) *Server {
+	return &Server{registry: registry, members: members, sequencing: sequencing, leadership: leadership, auditLog: auditLog}
+}
+
+// Register registers the cluster service on a gRPC server.
+func (s *Server) Register(gs *grpc.Server) {
+	gs.RegisterService(&serviceDesc, s)
+}
+
+// ReportHealth implements ClusterServer. The status is only recorded if it is sent by a
+// member of the raft configuration about itself: its ID must be a member, and the call must
+// come from the host of its raft address.
+func (s *Server) ReportHealth(ctx context.Context, status *PeerStatus) (*Empty, error) {
+	servers, err := s.members.Servers()
+	if err != nil {
+		return nil, err
+	}
+	var member *raft.Server
+	for i := range servers {
+		if string(servers[i].ID) == status.ID {
+			member = &servers[i]
+			break
+		}
+	}
+	if member == nil {
+		return nil, errors.Errorf("%s is not a member of the cluster", status.ID)
+	}
+	if err := checkSender(ctx, string(member.Address)); err != nil {
+		return nil, errors.Wrapf(err, "rejected health report of %s", status.ID)
+	}
+
+	status.Address = string(member.Address)
+	s.registry.Update(*status)
+	return &Empty{}, nil
+}
+
+// checkSender returns an error unless the call was made from one of the IPs the host of
+// addr resolves to.
+func checkSender(ctx context.Context, addr string) error {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return errors.New("unknown sender")
+	}
+	sender, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return errors.Wrapf(err, "invalid sender address %s", p.Addr)
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return errors.Wrapf(err, "invalid raft address %s", addr)
+	}
+	ips, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return errors.Wrapf(err, "failed to resolve %s", host)
+	}
+	senderIP := net.ParseIP(sender)
+	for _, ip := range ips {
+		if net.ParseIP(ip).Equal(senderIP) {
+			return nil
+		}
+	}
+	return errors.Errorf("sent from %s, not from %s", sender, host)
+}
+
+// ClusterHealth implements ClusterServer.
+func (s *Server) ClusterHealth(ctx context.Context, req *Empty) (*ClusterHealth, error) {
+	return &ClusterHealth{
+		Peers:            s.registry.All(),
+		SequencingPaused: s.sequencing.SequencingPaused(),
+	}, nil
+}
+
+// PauseSequencing implements ClusterServer.
+func (s *Server) PauseSequencing(ctx context.Context, req *PauseRequest) (*Empty, error) {
+	if err := s.sequencing.SetSequencingPaused(req.Paused); err != nil {
+		return nil, err
+	}
+	return &Empty{}, nil
+}
+
+// TransferLeadership implements ClusterServer.
+func (s *Server) TransferLeadership(ctx context.Context, req *TransferRequest) (*Empty, error) {
+	if err := s.leadership.TransferLeadership(ctx, req.To); err != nil {
+		return nil, err
+	}
+	return &Empty{}, nil
+}
+
+// AuditLog implements ClusterServer. At most maxAuditEntries are returned.
+func (s *Server) AuditLog(ctx context.Context, req *AuditRequest) (*AuditResponse, error) {
+	limit := req.Limit
+	if limit <= 0 || limit > maxAuditEntries {
+		limit = maxAuditEntries
+	}
+	entries, err := s.auditLog.Tail(req.After, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditResponse{Entries: entries}, nil
+}
+
+// Client calls the cluster service of other nodes, reusing one connection per address.
+// It is safe for concurrent use.
+type Client struct {
+	mu    sync.Mutex
+	conns map[string]*grpc.ClientConn
+}
+
+func NewClient() *Client {
+	return &Client{
+		conns: make(map[string]*grpc.ClientConn),
+	}
+}
+
+// ReportHealth sends the status of the local node to the node at addr.
+func (c *Client) ReportHealth(ctx context.Context, addr string, status PeerStatus) error {
+	conn, err := c.conn(addr)
+	if err != nil {
+		return err
+	}
+	return conn.Invoke(ctx, reportHealthMethod, &status, &Empty{}, grpc.CallContentSubtype(codecName))
+}
+
+// ClusterHealth returns the cluster-wide view of the node at addr.
+func (c *Client) ClusterHealth(ctx context.Context, addr string) (*ClusterHealth, error) {
+	conn, err := c.conn(addr)
+	if err != nil {
+		return nil, err
+	}
+	out := new(ClusterHealth)
+	if err := conn.Invoke(ctx, clusterHealthMethod, &Empty{}, out, grpc.CallContentSubtype(codecName)); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// PauseSequencing pauses or resumes sequencing through the leader at addr.
+func (c *Client) PauseSequencing(ctx context.Context, addr string, paused bool) error {
+	conn, err := c.conn(addr)
+	if err != nil {
+		return err
+	}
+	return conn.Invoke(ctx, pauseMethod, &PauseRequest{Paused: paused}, &Empty{}, grpc.CallContentSubtype(codecName))
+}
+
+// TransferLeadership hands leadership over through the leader at addr, to the server with
+// the given ID, or to the healthiest peer if it is empty.
+func (c *Client) TransferLeadership(ctx context.Context, addr, to string) error {
+	conn, err := c.conn(addr)
+	if err != nil {
+		return err
+	}
+	return conn.Invoke(ctx, transferMethod, &TransferRequest{To: to}, &Empty{}, grpc.CallContentSubtype(codecName))
+}
+
+// AuditLog returns the latest audit log entries of the node at addr.
+func (c *Client) AuditLog(ctx context.Context, addr string, after uint64, limit int) ([]audit.Entry, error) {
+	conn, err := c.conn(addr)
+	if err != nil {
+		return nil, err
+	}
+	out := new(AuditResponse)
+	req := &AuditRequest{After: after, Limit: limit}
+	if err := conn.Invoke(ctx, auditLogMethod, req, out, grpc.CallContentSubtype(codecName)); err != nil {
+		return nil, err
+	}
+	return out.Entries, nil
+}
+
+// Close closes every connection.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var firstErr error
+	for addr, conn := range c.conns {
+		if err := conn.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(c.conns, addr)
+	}
+	return firstErr
+}
+
+func (c *Client) conn(addr string) (*grpc.ClientConn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if conn, ok := c.conns[addr]; ok {
+		return conn, nil
+	}
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to dial %s", addr)
+	}
+	c.conns[addr] = conn
+	return conn, nil
+}
@@ -0,0 +1,63 @@
+package cluster
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	lh "github.com/base-org/leader-election/leader/health"
+	"github.com/hashicorp/raft"
+	"google.golang.org/grpc/peer"
+)
+
+type members []raft.Server
+
+func (m members) Servers() ([]raft.Server, error) { return m, nil }
+
+func from(ip string) context.Context {
+	return peer.NewContext(context.Background(), &peer.Peer{
+		Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 40000},
+	})
+}
+
+func TestReportHealth(t *testing.T) {
+	cluster := members{
+		{ID: "a", Address: "127.0.0.1:50051", Suffrage: raft.Voter},
+		{ID: "b", Address: "127.0.0.2:50052", Suffrage: raft.Voter},
+		{ID: "c", Address: "localhost:50053", Suffrage: raft.Nonvoter},
+	}
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		id      string
+		wantErr bool
+	}{
+		{name: "member reporting itself", ctx: from("127.0.0.1"), id: "a"},
+		{name: "member address resolved", ctx: from("127.0.0.1"), id: "c"},
+		{name: "unknown id", ctx: from("127.0.0.1"), id: "d", wantErr: true},
+		{name: "member reporting another one", ctx: from("127.0.0.1"), id: "b", wantErr: true},
+		{name: "unknown sender", ctx: context.Background(), id: "a", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := NewRegistry()
+			s := NewServer(registry, cluster, nil, nil, nil)
+
+			status := &PeerStatus{ID: tt.id, Address: "10.0.0.1:1", Report: lh.HealthReport{Healthy: true}}
+			_, err := s.ReportHealth(tt.ctx, status)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReportHealth() = %v, want error %t", err, tt.wantErr)
+			}
+
+			got, ok := registry.Get(tt.id, time.Minute)
+			if ok == tt.wantErr {
+				t.Fatalf("registry has a status for %s: %t, want %t", tt.id, ok, !tt.wantErr)
+			}
+			if ok && got.Address == "10.0.0.1:1" {
+				t.Errorf("recorded address %s, want the raft address", got.Address)
+			}
+		})
+	}
+}
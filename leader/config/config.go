@@ -1,6 +1,12 @@
 package config
 
-import "github.com/hashicorp/raft"
+import (
+	"time"
+
+	"github.com/base-org/leader-election/leader/rpc"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+)
 
 type Config struct {
 	RaftConfig    *raft.Config
@@ -14,6 +20,97 @@ type Config struct {
 	BatcherAddr string
 	GethAddr    string
 
+	// RPCTimeouts bounds every call made to op-node, op-batcher and op-geth.
+	RPCTimeouts rpc.Timeouts
+
+	// CatchUpTimeout is how long a new leader waits for its local geth to reach the
+	// committed unsafe head before giving up leadership.
+	CatchUpTimeout time.Duration
+
+	Health HealthConfig
+
+	Metrics MetricsConfig
+
+	Status StatusConfig
+
+	Tracing TracingConfig
+
+	Audit AuditConfig
+
+	Log LogConfig
+	// Logger is the root logger, created from Log once the configuration is valid.
+	Logger hclog.Logger
+
+	// ShutdownTimeout bounds the graceful shutdown on SIGINT or SIGTERM.
+	ShutdownTimeout time.Duration
+
 	Test            bool
 	HealthCheckPath string
 }
+
+// AuditConfig holds the rotation settings of the audit log kept in StorageDir.
+type AuditConfig struct {
+	// MaxSize is the size in bytes over which the audit log is rotated.
+	MaxSize int64
+	// MaxBackups is how many rotated files are kept.
+	MaxBackups int
+}
+
+// Tracing exporters.
+const (
+	TracingExporterNone   = "none"
+	TracingExporterStdout = "stdout"
+	TracingExporterOTLP   = "otlp"
+)
+
+// TracingConfig holds the settings of the OpenTelemetry trace exporter.
+type TracingConfig struct {
+	// Exporter is one of TracingExporterNone, TracingExporterStdout or TracingExporterOTLP.
+	Exporter string
+	// Endpoint is the OTLP/HTTP collector URL.
+	Endpoint string
+	// SampleRatio is the fraction of traces started by the elector that are sampled.
+	SampleRatio float64
+}
+
+// MetricsConfig holds the settings of the Prometheus metrics server.
+type MetricsConfig struct {
+	// Enabled serves the metrics on Addr.
+	Enabled bool
+	// Addr is the address the metrics server listens on.
+	Addr string
+}
+
+// StatusConfig holds the settings of the HTTP status server.
+type StatusConfig struct {
+	// Enabled serves the status and probes on Addr.
+	Enabled bool
+	// Addr is the address the status server listens on.
+	Addr string
+}
+
+// HealthConfig holds the thresholds of the sequencer health checks.
+type HealthConfig struct {
+	// Interval is how often health is checked.
+	Interval time.Duration
+	// UnsafeStallTimeout is how long the op-node unsafe head may stay still while sequencing.
+	UnsafeStallTimeout time.Duration
+	// MaxL1OriginLag is how many blocks the L1 origin of the unsafe head may trail the L1 head.
+	MaxL1OriginLag uint64
+	// MinPeers is the minimum op-geth peer count.
+	MinPeers uint64
+	// MaxBlockAge is how old the latest op-geth block may be while sequencing.
+	MaxBlockAge time.Duration
+
+	// FailureThreshold is how many consecutive failed checks make the sequencer unhealthy.
+	FailureThreshold int
+	// SuccessThreshold is how many consecutive passed checks make it healthy again.
+	SuccessThreshold int
+	// GracePeriod is how long a new leader is not judged on its health after an election.
+	GracePeriod time.Duration
+	// MinTransferInterval is the minimum time between two health-driven leadership transfers.
+	MinTransferInterval time.Duration
+	// MinVoters is the minimum number of voters the leader keeps when demoting unhealthy
+	// nodes to non-voters, a cluster of MinVoters voters or fewer never demotes any.
+	MinVoters int
+}
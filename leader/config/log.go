@@ -0,0 +1,40 @@
+package config
+
+import (
+	"os"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// Log formats.
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// LogConfig holds the settings of the elector logger.
+type LogConfig struct {
+	// Level is the minimum level logged: trace, debug, info, warn or error.
+	Level string
+	// Format is either LogFormatText or LogFormatJSON.
+	Format string
+}
+
+// NewLogger creates the root logger of the elector, every line it writes carries the ID
+// of the local node. Components derive their own logger with Named.
+func (c LogConfig) NewLogger(nodeID string) hclog.Logger {
+	return hclog.New(&hclog.LoggerOptions{
+		Level:      hclog.LevelFromString(c.Level),
+		JSONFormat: c.Format == LogFormatJSON,
+		Output:     os.Stderr,
+	}).With("node-id", nodeID)
+}
+
+func (c LogConfig) validate(add func(format string, args ...any)) {
+	if hclog.LevelFromString(c.Level) == hclog.NoLevel {
+		add("log-level %q: expected trace, debug, info, warn or error", c.Level)
+	}
+	if c.Format != LogFormatText && c.Format != LogFormatJSON {
+		add("log-format %q: expected %s or %s", c.Format, LogFormatText, LogFormatJSON)
+	}
+}
@@ -0,0 +1,194 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/raft"
+)
+
+// Files of the raft stores in the storage dir.
+const (
+	LogStoreFile    = "logs.dat"
+	StableStoreFile = "stable.dat"
+)
+
+// ValidationError lists every problem found by Config.Validate.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid configuration:\n  - %s", strings.Join(e.Problems, "\n  - "))
+}
+
+// Validate checks the configuration before the elector starts, and returns a
+// *ValidationError listing all problems found, or nil.
+func (c *Config) Validate() error {
+	var problems []string
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if c.RaftConfig == nil || c.RaftConfig.LocalID == "" {
+		add("server-id is required")
+	} else if err := raft.ValidateConfig(c.RaftConfig); err != nil {
+		add("invalid raft configuration: %v", err)
+	}
+
+	if err := checkHostPort(c.ServerAddr); err != nil {
+		add("server-addr %q: %v", c.ServerAddr, err)
+	}
+	if c.Metrics.Enabled {
+		if err := checkHostPort(c.Metrics.Addr); err != nil {
+			add("metrics-addr %q: %v", c.Metrics.Addr, err)
+		}
+	}
+	if c.Status.Enabled {
+		if err := checkHostPort(c.Status.Addr); err != nil {
+			add("status-addr %q: %v", c.Status.Addr, err)
+		}
+	}
+
+	if c.StorageDir == "" {
+		add("storage-dir is required")
+	} else {
+		if err := checkWritable(c.StorageDir); err != nil {
+			add("storage-dir %q: %v", c.StorageDir, err)
+		}
+		if c.Bootstrap && hasRaftState(c.StorageDir) {
+			add("bootstrap is set but %q already holds raft state, bootstrap only a new cluster", c.StorageDir)
+		}
+	}
+
+	for _, addr := range []struct{ flag, value string }{
+		{"op-node-addr", c.NodeAddr},
+		{"op-batcher-addr", c.BatcherAddr},
+		{"op-geth-addr", c.GethAddr},
+	} {
+		if addr.value == "" {
+			if !c.Test {
+				add("%s is required unless running in test mode", addr.flag)
+			}
+			continue
+		}
+		if err := checkURL(addr.value); err != nil {
+			add("%s %q: %v", addr.flag, addr.value, err)
+		}
+	}
+	if !c.Test && c.HealthCheckPath != "" {
+		add("health-check-path is only used in test mode")
+	}
+	c.Log.validate(add)
+
+	switch c.Tracing.Exporter {
+	case TracingExporterNone, TracingExporterStdout:
+	case TracingExporterOTLP:
+		if err := checkURL(c.Tracing.Endpoint); err != nil {
+			add("tracing-endpoint %q: %v", c.Tracing.Endpoint, err)
+		}
+	default:
+		add("tracing-exporter %q: expected %s, %s or %s", c.Tracing.Exporter, TracingExporterNone, TracingExporterStdout, TracingExporterOTLP)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		add("tracing-sample-ratio must be between 0 and 1")
+	}
+
+	for _, d := range []struct {
+		flag  string
+		value int64
+	}{
+		{"rpc-timeout", int64(c.RPCTimeouts.Default)},
+		{"catch-up-timeout", int64(c.CatchUpTimeout)},
+		{"shutdown-timeout", int64(c.ShutdownTimeout)},
+		{"health-interval", int64(c.Health.Interval)},
+		{"health-failure-threshold", int64(c.Health.FailureThreshold)},
+		{"health-success-threshold", int64(c.Health.SuccessThreshold)},
+		{"health-min-voters", int64(c.Health.MinVoters)},
+		{"audit-max-size-mb", c.Audit.MaxSize},
+		{"audit-max-backups", int64(c.Audit.MaxBackups)},
+	} {
+		if d.value <= 0 {
+			add("%s must be positive", d.flag)
+		}
+	}
+	for method, d := range c.RPCTimeouts.Methods {
+		if d <= 0 {
+			add("rpc-method-timeout for %s must be positive", method)
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func checkHostPort(addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+		return fmt.Errorf("invalid port %q", port)
+	}
+	return nil
+}
+
+func checkURL(addr string) error {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("expected an http or https URL")
+	}
+	if u.Host == "" {
+		return fmt.Errorf("missing host")
+	}
+	if port := u.Port(); port != "" {
+		return checkHostPort(u.Host)
+	}
+	return nil
+}
+
+// checkWritable checks that dir, or its closest existing parent if it does not exist yet,
+// is a directory the elector can write to.
+func checkWritable(dir string) error {
+	for {
+		info, err := os.Stat(dir)
+		if os.IsNotExist(err) && filepath.Dir(dir) != dir {
+			dir = filepath.Dir(dir)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", dir)
+		}
+		break
+	}
+
+	f, err := os.CreateTemp(dir, ".write-check-")
+	if err != nil {
+		return fmt.Errorf("not writable: %w", err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// hasRaftState returns true if the raft stores were already created in dir.
+func hasRaftState(dir string) bool {
+	for _, name := range []string{LogStoreFile, StableStoreFile} {
+		if info, err := os.Stat(filepath.Join(dir, name)); err == nil && info.Size() > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,206 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/base-org/leader-election/leader/rpc"
+	"github.com/hashicorp/raft"
+)
+
+// validConfig returns a configuration that passes Validate, storing in a new temp dir.
+func validConfig(t *testing.T) *Config {
+	rc := raft.DefaultConfig()
+	rc.LocalID = "node-1"
+	return &Config{
+		RaftConfig:      rc,
+		ServerAddr:      "127.0.0.1:50051",
+		StorageDir:      t.TempDir(),
+		NodeAddr:        "http://op-node:8545",
+		BatcherAddr:     "http://op-batcher:8545",
+		GethAddr:        "https://op-geth:8545",
+		RPCTimeouts:     rpc.Timeouts{Default: time.Second},
+		CatchUpTimeout:  time.Minute,
+		ShutdownTimeout: time.Minute,
+		Health: HealthConfig{
+			Interval:         time.Second,
+			FailureThreshold: 1,
+			SuccessThreshold: 1,
+			MinVoters:        2,
+		},
+		Audit:   AuditConfig{MaxSize: 1 << 20, MaxBackups: 1},
+		Tracing: TracingConfig{Exporter: TracingExporterNone},
+		Log:     LogConfig{Level: "info", Format: LogFormatText},
+	}
+}
+
+// problems returns the problems reported by Validate, or nil if it passed.
+func problems(t *testing.T, c *Config) []string {
+	t.Helper()
+	err := c.Validate()
+	if err == nil {
+		return nil
+	}
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("Validate() = %T, want a *ValidationError", err)
+	}
+	return verr.Problems
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(t *testing.T, c *Config)
+		// want holds a substring of each problem expected, in order.
+		want []string
+	}{
+		{
+			name:   "valid",
+			modify: func(t *testing.T, c *Config) {},
+		},
+		{
+			name: "test mode needs no control addresses",
+			modify: func(t *testing.T, c *Config) {
+				c.Test, c.NodeAddr, c.BatcherAddr, c.GethAddr = true, "", "", ""
+			},
+		},
+		{
+			name: "bootstrap on a new storage dir",
+			modify: func(t *testing.T, c *Config) {
+				c.Bootstrap = true
+			},
+		},
+		{
+			name: "bootstrap on existing raft state",
+			modify: func(t *testing.T, c *Config) {
+				c.Bootstrap = true
+				if err := os.WriteFile(filepath.Join(c.StorageDir, LogStoreFile), []byte("state"), 0o644); err != nil {
+					t.Fatalf("failed to write raft state: %v", err)
+				}
+			},
+			want: []string{"already holds raft state"},
+		},
+		{
+			name: "bad url scheme",
+			modify: func(t *testing.T, c *Config) {
+				c.NodeAddr = "ws://op-node:8546"
+			},
+			want: []string{`op-node-addr "ws://op-node:8546": expected an http or https URL`},
+		},
+		{
+			name: "url without host",
+			modify: func(t *testing.T, c *Config) {
+				c.GethAddr = "http://"
+			},
+			want: []string{`op-geth-addr "http://": missing host`},
+		},
+		{
+			name: "url with bad port",
+			modify: func(t *testing.T, c *Config) {
+				c.BatcherAddr = "http://op-batcher:99999"
+			},
+			want: []string{`op-batcher-addr "http://op-batcher:99999": invalid port`},
+		},
+		{
+			name: "bare host",
+			modify: func(t *testing.T, c *Config) {
+				c.NodeAddr = "foo"
+			},
+			want: []string{`op-node-addr "foo": expected an http or https URL`},
+		},
+		{
+			name: "storage dir under a file",
+			modify: func(t *testing.T, c *Config) {
+				file := filepath.Join(c.StorageDir, "file")
+				if err := os.WriteFile(file, nil, 0o644); err != nil {
+					t.Fatalf("failed to write file: %v", err)
+				}
+				c.StorageDir = filepath.Join(file, "node-1")
+			},
+			want: []string{"not a directory"},
+		},
+		{
+			name: "every problem is reported",
+			modify: func(t *testing.T, c *Config) {
+				c.RaftConfig.LocalID = ""
+				c.ServerAddr = "localhost"
+				c.NodeAddr = "foo"
+				c.BatcherAddr = ""
+				c.HealthCheckPath = "/tmp/health"
+				c.Log.Level = "loud"
+				c.Tracing.SampleRatio = 2
+				c.Health.Interval = 0
+			},
+			want: []string{
+				"server-id is required",
+				`server-addr "localhost"`,
+				`op-node-addr "foo"`,
+				"op-batcher-addr is required unless running in test mode",
+				"health-check-path is only used in test mode",
+				`log-level "loud"`,
+				"tracing-sample-ratio must be between 0 and 1",
+				"health-interval must be positive",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := validConfig(t)
+			tt.modify(t, c)
+
+			got := problems(t, c)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Validate() problems = %q, want %d problems", got, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.Contains(got[i], want) {
+					t.Errorf("problem %d = %q, want it to contain %q", i, got[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateReadOnlyStorageDir(t *testing.T) {
+	c := validConfig(t)
+	if err := os.Chmod(c.StorageDir, 0o555); err != nil {
+		t.Fatalf("failed to make storage dir read-only: %v", err)
+	}
+	t.Cleanup(func() { os.Chmod(c.StorageDir, 0o755) })
+	if f, err := os.CreateTemp(c.StorageDir, "probe-"); err == nil {
+		f.Close()
+		os.Remove(f.Name())
+		t.Skip("permissions are not enforced for this user")
+	}
+
+	got := problems(t, c)
+	if len(got) != 1 || !strings.Contains(got[0], "not writable") {
+		t.Errorf("Validate() problems = %q, want the storage dir not writable", got)
+	}
+}
+
+func TestValidateReadOnlyFilesystem(t *testing.T) {
+	// procfs is read-only even for root, unlike a directory without write permission.
+	if _, err := os.Stat("/proc/self"); err != nil {
+		t.Skip("no procfs")
+	}
+	c := validConfig(t)
+	c.StorageDir = "/proc/leader-election/node-1"
+
+	got := problems(t, c)
+	if len(got) != 1 || !strings.Contains(got[0], "not writable") {
+		t.Errorf("Validate() problems = %q, want the storage dir not writable", got)
+	}
+}
+
+func TestValidateMissingStorageDirIsCreatable(t *testing.T) {
+	c := validConfig(t)
+	c.StorageDir = filepath.Join(c.StorageDir, "raft", "node-1")
+	if got := problems(t, c); got != nil {
+		t.Errorf("Validate() problems = %q, want none for a dir that can be created", got)
+	}
+}
@@ -0,0 +1,171 @@
+package leader
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/base-org/leader-election/leader/cluster"
+	"github.com/base-org/leader-election/leader/fsm"
+	"github.com/base-org/leader-election/leader/rpc"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+)
+
+// Consensus is the subset of the raft cluster the StateMachine relies on.
+type Consensus interface {
+	// Barrier blocks until all committed logs have been applied to the FSM.
+	Barrier() error
+	// CommittedHead returns the last unsafe head committed by the cluster.
+	CommittedHead() fsm.Head
+	// FencingToken returns the fencing token of the current leadership term. It must be
+	// called by the leader after Barrier.
+	FencingToken() (rpc.FencingToken, error)
+	// CommitHead replicates a new unsafe head to the cluster on behalf of the leader holding
+	// the fencing token.
+	CommitHead(head fsm.Head, token rpc.FencingToken) error
+	// SequencingPaused returns true if operators paused sequencing cluster-wide.
+	SequencingPaused() bool
+	// Term returns the current raft term, or 0 if it is unknown.
+	Term() uint64
+	// TransferLeadership hands leadership over to another node, preferably a healthy one.
+	TransferLeadership() error
+}
+
+type raftConsensus struct {
+	log     hclog.Logger
+	raft    *raft.Raft
+	fsm     *fsm.UnsafeHeadFSM
+	localID raft.ServerID
+	// peers holds the health reported by the other nodes, statuses older than
+	// peerStatusMaxAge are ignored when picking the next leader.
+	peers            *cluster.Registry
+	peerStatusMaxAge time.Duration
+}
+
+var _ Consensus = (*raftConsensus)(nil)
+
+// Barrier implements Consensus.
+func (c *raftConsensus) Barrier() error {
+	if err := c.raft.Barrier(barrierTimeout).Error(); err != nil {
+		return errors.Wrap(err, "failed to apply committed logs")
+	}
+	return nil
+}
+
+// CommittedHead implements Consensus.
+func (c *raftConsensus) CommittedHead() fsm.Head {
+	return c.fsm.Head()
+}
+
+// SequencingPaused implements Consensus.
+func (c *raftConsensus) SequencingPaused() bool {
+	return c.fsm.SequencingPaused()
+}
+
+// Term implements Consensus.
+func (c *raftConsensus) Term() uint64 {
+	term, _ := c.term()
+	return term
+}
+
+func (c *raftConsensus) term() (uint64, error) {
+	// raft.Raft only exposes the current term through its stats.
+	term, err := strconv.ParseUint(c.raft.Stats()["term"], 10, 64)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to parse raft term")
+	}
+	return term, nil
+}
+
+// FencingToken implements Consensus. The token is the current raft term and the last
+// applied index, which is at least the index of the barrier written in this term.
+func (c *raftConsensus) FencingToken() (rpc.FencingToken, error) {
+	term, err := c.term()
+	if err != nil {
+		return rpc.FencingToken{}, err
+	}
+	return rpc.FencingToken{Term: term, Index: c.raft.AppliedIndex()}, nil
+}
+
+// CommitHead implements Consensus.
+func (c *raftConsensus) CommitHead(head fsm.Head, token rpc.FencingToken) error {
+	cmd, err := fsm.NewSetUnsafeHead(head, token)
+	if err != nil {
+		return err
+	}
+	return c.apply(cmd)
+}
+
+// apply commits an encoded fsm.Command and returns the error returned by the FSM, if any.
+func (c *raftConsensus) apply(cmd []byte) error {
+	f := c.raft.Apply(cmd, applyTimeout)
+	if err := f.Error(); err != nil {
+		return errors.Wrap(err, "failed to apply command")
+	}
+	if err, ok := f.Response().(error); ok {
+		return err
+	}
+	return nil
+}
+
+// TransferLeadership implements Consensus. It hands leadership to the healthiest, most
+// caught up peer, and lets raft pick one if no peer reported its health or none is healthy:
+// a node that must not lead is better off handing leadership to any peer.
+func (c *raftConsensus) TransferLeadership() error {
+	return c.transferLeadership(false)
+}
+
+// transferLeadership hands leadership to the healthiest, most caught up peer. If no peer
+// reported its health, raft picks one. If none of those that reported is healthy, it returns
+// ErrNoHealthyPeer when requireHealthy is set, and lets raft pick one otherwise.
+func (c *raftConsensus) transferLeadership(requireHealthy bool) error {
+	future := c.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return errors.Wrap(err, "failed to get raft configuration")
+	}
+
+	target, ok, err := transferTarget(future.Configuration().Servers, c.localID, c.peers, c.peerStatusMaxAge)
+	if err != nil && (requireHealthy || !errors.Is(err, ErrNoHealthyPeer)) {
+		return err
+	}
+
+	var f raft.Future
+	switch {
+	case ok:
+		c.log.Info("transferring leadership", "term", c.Term(), "target", target.ID, "address", target.Address)
+		f = c.raft.LeadershipTransferToServer(target.ID, target.Address)
+	case err != nil:
+		c.log.Warn("no healthy peer, transferring leadership to any peer", "term", c.Term())
+		f = c.raft.LeadershipTransfer()
+	default:
+		c.log.Info("no peer reported its health, transferring leadership to any peer", "term", c.Term())
+		f = c.raft.LeadershipTransfer()
+	}
+	if err := f.Error(); err != nil {
+		return errors.Wrap(err, "failed to transfer leadership")
+	}
+	return nil
+}
+
+// transferLeadershipTo hands leadership to the voter with the given ID, whatever its health.
+func (c *raftConsensus) transferLeadershipTo(id raft.ServerID) error {
+	future := c.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return errors.Wrap(err, "failed to get raft configuration")
+	}
+	for _, srv := range future.Configuration().Servers {
+		if srv.ID != id || id == c.localID {
+			continue
+		}
+		if srv.Suffrage != raft.Voter {
+			return errors.Errorf("server %s is not a voter", id)
+		}
+		c.log.Info("transferring leadership", "term", c.Term(), "target", srv.ID, "address", srv.Address)
+		if err := c.raft.LeadershipTransferToServer(srv.ID, srv.Address).Error(); err != nil {
+			return errors.Wrapf(err, "failed to transfer leadership to %s", id)
+		}
+		return nil
+	}
+	return errors.Errorf("server %s is not a peer of the cluster", id)
+}
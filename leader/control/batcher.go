@@ -1,12 +1,11 @@
 package control
 
 import (
-	"fmt"
-	"net/http"
+	"context"
 
+	"github.com/base-org/leader-election/leader/metrics"
 	"github.com/base-org/leader-election/leader/rpc"
-	"github.com/ethereum/go-ethereum/log"
-	"github.com/pkg/errors"
+	"github.com/hashicorp/go-hclog"
 )
 
 const (
@@ -15,76 +14,71 @@ const (
 )
 
 type BatcherRPC interface {
-	StartBatcher() error
-	StopBatcher() error
+	StartBatcher(ctx context.Context) error
+	StopBatcher(ctx context.Context) error
 }
 
 type BatcherRPCClient struct {
-	serverAddr string
-	client     *http.Client
+	client  *rpc.Client
+	log     hclog.Logger
+	metrics *metrics.Metrics
 }
 
 var _ BatcherRPC = (*BatcherRPCClient)(nil)
 
-func NewBatcherRPC(serverAddr string) BatcherRPC {
+func NewBatcherRPC(serverAddr string, timeouts rpc.Timeouts, log hclog.Logger, m *metrics.Metrics) BatcherRPC {
 	return &BatcherRPCClient{
-		serverAddr: serverAddr,
-		client:     &http.Client{},
+		client:  rpc.NewClient(serverAddr, timeouts, log),
+		log:     log,
+		metrics: m,
 	}
 }
 
-// StartBatcher implements IBatcherAdmin.
-func (b *BatcherRPCClient) StartBatcher() error {
-	req := rpc.JSONRPCRequest{
-		Version: rpc.DefaultJsonRPCVersion,
-		Method:  StartBatcherMethod,
-		Params:  []any{},
-		ID:      0,
+// StartBatcher implements BatcherRPC. It returns ErrBatcherAlreadyStarted if the batcher
+// is already running.
+func (b *BatcherRPCClient) StartBatcher(ctx context.Context) error {
+	if err := call(ctx, b.client, b.metrics, StartBatcherMethod, nil, nil); err != nil {
+		return classify(err, ErrBatcherAlreadyStarted)
 	}
-
-	if _, err := rpc.Post(b.client, b.serverAddr, req); err != nil {
-		return errors.Wrap(err, "failed to send request")
-	}
-
-	fmt.Println("Batcher started...")
-
+	b.log.Info("batcher started")
 	return nil
 }
 
-// StopBatcher implements IBatcherAdmin.
-func (b *BatcherRPCClient) StopBatcher() error {
-	req := rpc.JSONRPCRequest{
-		Version: rpc.DefaultJsonRPCVersion,
-		Method:  StopBatcherMethod,
-		Params:  []any{},
-		ID:      0,
-	}
-
-	if _, err := rpc.Post(b.client, b.serverAddr, req); err != nil {
-		return errors.Wrap(err, "failed to send request")
+// StopBatcher implements BatcherRPC. It returns ErrBatcherAlreadyStopped if the batcher
+// is not running.
+func (b *BatcherRPCClient) StopBatcher(ctx context.Context) error {
+	if err := call(ctx, b.client, b.metrics, StopBatcherMethod, nil, nil); err != nil {
+		return classify(err, ErrBatcherAlreadyStopped)
 	}
-
-	fmt.Println("Batcher stopped...")
-
+	b.log.Info("batcher stopped")
 	return nil
 }
 
-type MockBatcherRPC struct{}
+type MockBatcherRPC struct {
+	mockErrors
+	log hclog.Logger
+}
 
 var _ BatcherRPC = (*MockBatcherRPC)(nil)
 
-func NewMockBatcherRPC() BatcherRPC {
-	return &MockBatcherRPC{}
+func NewMockBatcherRPC(log hclog.Logger) BatcherRPC {
+	return &MockBatcherRPC{log: log}
 }
 
 // StartBatcher implements BatcherRPC.
-func (m *MockBatcherRPC) StartBatcher() error {
-	log.Info("MockBatcherRPC: StartBatcher")
+func (m *MockBatcherRPC) StartBatcher(ctx context.Context) error {
+	if err := m.err(StartBatcherMethod); err != nil {
+		return err
+	}
+	m.log.Info("mock batcher started")
 	return nil
 }
 
 // StopBatcher implements BatcherRPC.
-func (m *MockBatcherRPC) StopBatcher() error {
-	log.Info("MockBatcherRPC: StopBatcher")
+func (m *MockBatcherRPC) StopBatcher(ctx context.Context) error {
+	if err := m.err(StopBatcherMethod); err != nil {
+		return err
+	}
+	m.log.Info("mock batcher stopped")
 	return nil
 }
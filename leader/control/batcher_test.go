@@ -0,0 +1,44 @@
+package control
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/base-org/leader-election/leader/rpc"
+	"github.com/hashicorp/go-hclog"
+)
+
+func TestBatcherRPC(t *testing.T) {
+	srv := newFakeServer(t)
+	batcher := NewBatcherRPC(srv.URL, rpc.Timeouts{}, hclog.NewNullLogger(), nil)
+	ctx := context.Background()
+
+	if err := batcher.StartBatcher(ctx); err != nil {
+		t.Fatalf("StartBatcher() = %v", err)
+	}
+	if err := batcher.StopBatcher(ctx); err != nil {
+		t.Fatalf("StopBatcher() = %v", err)
+	}
+
+	srv.errors[StartBatcherMethod] = &rpc.JSONRPCError{Code: -32000, Message: "batcher is already running"}
+	srv.errors[StopBatcherMethod] = &rpc.JSONRPCError{Code: -32000, Message: "batcher is not running"}
+	if err := batcher.StartBatcher(ctx); !errors.Is(err, ErrBatcherAlreadyStarted) {
+		t.Errorf("StartBatcher() = %v, want %v", err, ErrBatcherAlreadyStarted)
+	}
+	if err := batcher.StopBatcher(ctx); !errors.Is(err, ErrBatcherAlreadyStopped) {
+		t.Errorf("StopBatcher() = %v, want %v", err, ErrBatcherAlreadyStopped)
+	}
+
+	methods := srv.methods()
+	want := []string{StartBatcherMethod, StopBatcherMethod, StartBatcherMethod, StopBatcherMethod}
+	if len(methods) != len(want) {
+		t.Fatalf("methods called = %v, want %v", methods, want)
+	}
+	for i := range want {
+		if methods[i] != want[i] {
+			t.Errorf("methods called = %v, want %v", methods, want)
+			break
+		}
+	}
+}
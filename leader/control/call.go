@@ -0,0 +1,17 @@
+package control
+
+import (
+	"context"
+	"time"
+
+	"github.com/base-org/leader-election/leader/metrics"
+	"github.com/base-org/leader-election/leader/rpc"
+)
+
+// call makes a JSON-RPC call and records its outcome in the control call metrics.
+func call(ctx context.Context, client *rpc.Client, m *metrics.Metrics, method string, params []any, result any) error {
+	start := time.Now()
+	err := client.Call(ctx, method, params, result)
+	m.RecordControlCall(method, time.Since(start), err)
+	return err
+}
@@ -0,0 +1,36 @@
+package control
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/base-org/leader-election/leader/rpc"
+	"github.com/pkg/errors"
+)
+
+// Errors returned by op-node and op-batcher when the requested state is already reached.
+// They wrap the *rpc.JSONRPCError returned by the server.
+var (
+	ErrSequencerAlreadyStarted = errors.New("sequencer already running")
+	ErrSequencerAlreadyStopped = errors.New("sequencer not running")
+	ErrBatcherAlreadyStarted   = errors.New("batcher is already running")
+	ErrBatcherAlreadyStopped   = errors.New("batcher is not running")
+	// ErrStaleFencingToken is returned when the call was rejected because a newer leader
+	// already presented a higher fencing token.
+	ErrStaleFencingToken = errors.New("stale fencing token")
+)
+
+// classify maps a JSON-RPC error whose message matches one of the known errors to that
+// error, so callers can use errors.Is on it. Other errors are returned unchanged.
+func classify(err error, known ...error) error {
+	jerr, ok := rpc.AsJSONRPCError(err)
+	if !ok {
+		return err
+	}
+	for _, k := range known {
+		if strings.Contains(jerr.Message, k.Error()) {
+			return fmt.Errorf("%w: %w", k, err)
+		}
+	}
+	return err
+}
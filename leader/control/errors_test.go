@@ -0,0 +1,43 @@
+package control
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/base-org/leader-election/leader/rpc"
+)
+
+func TestClassify(t *testing.T) {
+	known := []error{ErrSequencerAlreadyStarted, ErrStaleFencingToken}
+	transport := &rpc.TransportError{URL: "http://op-node", Err: errors.New("connection refused")}
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{name: "known message", err: &rpc.JSONRPCError{Code: -32000, Message: "sequencer already running"}, want: ErrSequencerAlreadyStarted},
+		{name: "known message with details", err: &rpc.JSONRPCError{Code: -32000, Message: "stale fencing token: 2/1 < 3/1"}, want: ErrStaleFencingToken},
+		{name: "unknown message", err: &rpc.JSONRPCError{Code: -32000, Message: "sequencer not running"}},
+		{name: "not a json-rpc error", err: transport},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := classify(tt.err, known...)
+			for _, k := range known {
+				if errors.Is(got, k) != (k == tt.want) {
+					t.Errorf("errors.Is(classify(), %v) = %t, want %t", k, errors.Is(got, k), k == tt.want)
+				}
+			}
+			// The original error stays available to the caller.
+			if _, ok := rpc.AsJSONRPCError(tt.err); ok {
+				if _, ok := rpc.AsJSONRPCError(got); !ok {
+					t.Errorf("classify() = %v, lost the json-rpc error", got)
+				}
+			}
+			if rpc.IsUnavailable(got) != rpc.IsUnavailable(tt.err) {
+				t.Errorf("IsUnavailable(classify()) = %t, want %t", rpc.IsUnavailable(got), rpc.IsUnavailable(tt.err))
+			}
+		})
+	}
+}
@@ -1,83 +1,104 @@
 package control
 
 import (
-	"encoding/json"
+	"context"
+	"encoding/binary"
 	"fmt"
-	"io"
-	"net/http"
+	"time"
 
+	"github.com/base-org/leader-election/leader/metrics"
 	"github.com/base-org/leader-election/leader/rpc"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/pkg/errors"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/hashicorp/go-hclog"
 )
 
+// BlockRef identifies an L2 block by hash and number.
+type BlockRef struct {
+	Hash   common.Hash
+	Number uint64
+}
+
+const GetBlockByNumberMethod = "eth_getBlockByNumber"
+
 type GethRPC interface {
-	LatestBlock() (common.Hash, error)
+	LatestBlock(ctx context.Context) (BlockRef, error)
+	BlockByNumber(ctx context.Context, number uint64) (BlockRef, error)
 }
 
 type GethRPCClient struct {
-	serverAddr string
-	client     *http.Client
+	client  *rpc.Client
+	log     hclog.Logger
+	metrics *metrics.Metrics
 }
 
 var _ GethRPC = (*GethRPCClient)(nil)
 
-func NewGethRPC(serverAddr string) GethRPC {
-	fmt.Printf("NewGethRPC: %s\n", serverAddr)
+func NewGethRPC(serverAddr string, timeouts rpc.Timeouts, log hclog.Logger, m *metrics.Metrics) GethRPC {
 	return &GethRPCClient{
-		serverAddr: serverAddr,
-		client:     &http.Client{},
+		client:  rpc.NewClient(serverAddr, timeouts, log),
+		log:     log,
+		metrics: m,
 	}
 }
 
-// LatestBlock implements NodeRPC.
-func (g *GethRPCClient) LatestBlock() (common.Hash, error) {
-	req := rpc.JSONRPCRequest{
-		Version: rpc.DefaultJsonRPCVersion,
-		Method:  "eth_getBlockByNumber",
-		Params:  []any{"latest", true},
-		ID:      0,
-	}
+// LatestBlock implements GethRPC.
+func (g *GethRPCClient) LatestBlock(ctx context.Context) (BlockRef, error) {
+	return g.blockByTag(ctx, "latest")
+}
 
-	resp, err := rpc.Post(g.client, g.serverAddr, req)
-	if err != nil {
-		return common.Hash{}, errors.Wrap(err, "failed to send request")
-	}
+// BlockByNumber implements GethRPC.
+func (g *GethRPCClient) BlockByNumber(ctx context.Context, number uint64) (BlockRef, error) {
+	return g.blockByTag(ctx, hexutil.EncodeUint64(number))
+}
 
-	bytes, err := io.ReadAll(resp.Body)
-	fmt.Println(string(bytes))
-	if err != nil {
-		return common.Hash{}, errors.Wrap(err, "failed to read response body")
+func (g *GethRPCClient) blockByTag(ctx context.Context, tag string) (BlockRef, error) {
+	var block *rpc.Block
+	if err := call(ctx, g.client, g.metrics, GetBlockByNumberMethod, []any{tag, false}, &block); err != nil {
+		return BlockRef{}, err
 	}
-
-	var result rpc.JSONRPCResponse
-	if err := json.Unmarshal(bytes, &result); err != nil {
-		return common.Hash{}, errors.Wrap(err, "failed to unmarshal response body")
+	if block == nil {
+		return BlockRef{}, fmt.Errorf("block %s not found", tag)
 	}
-	fmt.Println(result.Result)
 
-	blockData, err := json.Marshal(result.Result)
-	if err != nil {
-		return common.Hash{}, errors.Wrap(err, "failed to marshal result")
-	}
+	return BlockRef{Hash: block.Hash, Number: uint64(block.Number)}, nil
+}
 
-	var block rpc.Block
-	if err := json.Unmarshal(blockData, &block); err != nil {
-		return common.Hash{}, errors.Wrap(err, "failed to unmarshal response body")
-	}
+// mockBlockTime is the block time of the chain simulated by MockGethRPC.
+const mockBlockTime = 2 * time.Second
 
-	return common.HexToHash(block.Hash), nil
+// MockGethRPC simulates a chain producing a block every mockBlockTime since the Unix epoch,
+// whose block hashes are derived from their number. Every mock in a test cluster sees the
+// same chain, so a new leader is always caught up.
+type MockGethRPC struct {
+	mockErrors
 }
 
-type MockGethRPC struct{}
-
 var _ GethRPC = (*MockGethRPC)(nil)
 
 func NewMockGethRPC() GethRPC {
 	return &MockGethRPC{}
 }
 
-// LatestBlock implements NodeRPC.
-func (*MockGethRPC) LatestBlock() (common.Hash, error) {
-	return common.Hash{}, nil
+// LatestBlock implements GethRPC.
+func (m *MockGethRPC) LatestBlock(ctx context.Context) (BlockRef, error) {
+	if err := m.err(GetBlockByNumberMethod); err != nil {
+		return BlockRef{}, err
+	}
+	return mockBlock(uint64(time.Now().UnixNano() / int64(mockBlockTime))), nil
+}
+
+// BlockByNumber implements GethRPC.
+func (m *MockGethRPC) BlockByNumber(ctx context.Context, number uint64) (BlockRef, error) {
+	if err := m.err(GetBlockByNumberMethod); err != nil {
+		return BlockRef{}, err
+	}
+	return mockBlock(number), nil
+}
+
+func mockBlock(number uint64) BlockRef {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], number)
+	return BlockRef{Hash: crypto.Keccak256Hash(buf[:]), Number: number}
 }
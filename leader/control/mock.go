@@ -0,0 +1,26 @@
+package control
+
+import "sync"
+
+// mockErrors holds the errors the mocks return instead of calling a method, so that tests
+// can simulate failing components.
+type mockErrors struct {
+	mu   sync.Mutex
+	errs map[string]error
+}
+
+// SetError makes every call of the JSON-RPC method return err, or succeed again if err is nil.
+func (m *mockErrors) SetError(method string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.errs == nil {
+		m.errs = make(map[string]error)
+	}
+	m.errs[method] = err
+}
+
+func (m *mockErrors) err(method string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.errs[method]
+}
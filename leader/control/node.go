@@ -1,168 +1,135 @@
 package control
 
 import (
-	"encoding/json"
-	"fmt"
-	"io"
-	"net/http"
+	"context"
+	"sync"
 
+	"github.com/base-org/leader-election/leader/metrics"
 	"github.com/base-org/leader-election/leader/rpc"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/log"
-	"github.com/pkg/errors"
+	"github.com/hashicorp/go-hclog"
+	"go.uber.org/atomic"
 )
 
 const (
-	StartSequencerMethod = "admin_startSequencer"
-	StopSequencerMethod  = "admin_stopSequencer"
+	StartSequencerMethod  = "admin_startSequencer"
+	StopSequencerMethod   = "admin_stopSequencer"
+	SequencerActiveMethod = "admin_sequencerActive"
 )
 
 type NodeRPC interface {
-	StartSequencer(hsh common.Hash) error
-	StopSequencer() (common.Hash, error)
-	SequencerActive() (bool, error)
+	// StartSequencer starts the sequencer on the given head on behalf of the leader holding
+	// the fencing token. It returns ErrStaleFencingToken if a newer leader started it since.
+	StartSequencer(ctx context.Context, hsh common.Hash, token rpc.FencingToken) error
+	StopSequencer(ctx context.Context) (common.Hash, error)
+	SequencerActive(ctx context.Context) (bool, error)
 }
 
 type NodeRPCClient struct {
-	serverAddr string
-	client     *http.Client
+	client  *rpc.Client
+	log     hclog.Logger
+	metrics *metrics.Metrics
 }
 
 var _ NodeRPC = (*NodeRPCClient)(nil)
 
-func NewNodeRPC(serverAddr string) NodeRPC {
+func NewNodeRPC(serverAddr string, timeouts rpc.Timeouts, log hclog.Logger, m *metrics.Metrics) NodeRPC {
 	return &NodeRPCClient{
-		serverAddr: serverAddr,
-		client:     &http.Client{},
+		client:  rpc.NewClient(serverAddr, timeouts, log),
+		log:     log,
+		metrics: m,
 	}
 }
 
-// StartSequencer implements INodeAdmin.
-func (n *NodeRPCClient) StartSequencer(hsh common.Hash) error {
-	fmt.Printf("Starting sequencer at %s", hsh.String())
-
-	req := rpc.JSONRPCRequest{
-		Version: rpc.DefaultJsonRPCVersion,
-		Method:  StartSequencerMethod,
-		Params:  []any{hsh.String()},
-		ID:      0,
-	}
-
-	resp, err := rpc.Post(n.client, n.serverAddr, req)
-	if err != nil {
-		return errors.Wrap(err, "failed to send request")
-	}
-
-	bytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return errors.Wrap(err, "failed to read response body")
+// StartSequencer implements NodeRPC. It returns ErrSequencerAlreadyStarted if the
+// sequencer is already running. The fencing token is sent in the rpc.FencingTokenHeader,
+// as admin_startSequencer only takes the head.
+func (n *NodeRPCClient) StartSequencer(ctx context.Context, hsh common.Hash, token rpc.FencingToken) error {
+	n.log.Info("starting sequencer", "head", hsh, "token", token, "term", token.Term)
+	ctx = rpc.WithFencingToken(ctx, token)
+	if err := call(ctx, n.client, n.metrics, StartSequencerMethod, []any{hsh}, nil); err != nil {
+		return classify(err, ErrSequencerAlreadyStarted, ErrStaleFencingToken)
 	}
-
-	var r rpc.JSONRPCResponse
-	if err := json.Unmarshal(bytes, &r); err != nil {
-		return errors.Wrap(err, "failed to unmarshal response body")
-	}
-
-	fmt.Println(r.Result)
-	if r.Error != nil {
-		fmt.Println(r.Error.Error())
-	}
-
-	fmt.Println("Sequencer started...")
-
+	n.log.Info("sequencer started", "head", hsh, "term", token.Term)
 	return nil
 }
 
-// StopSequencer implements INodeAdmin.
-func (n *NodeRPCClient) StopSequencer() (common.Hash, error) {
-	req := rpc.JSONRPCRequest{
-		Version: rpc.DefaultJsonRPCVersion,
-		Method:  StopSequencerMethod,
-		Params:  []any{},
-		ID:      0,
-	}
-
-	resp, err := rpc.Post(n.client, n.serverAddr, req)
-	if err != nil {
-		return common.Hash{}, errors.Wrap(err, "failed to send request")
-	}
-	defer resp.Body.Close()
-
-	bytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return common.Hash{}, errors.Wrap(err, "failed to read response body")
-	}
-
-	// TODO: place holder, need to change to correct unmarshalling code.
-	var r rpc.JSONRPCResponse
-	if err := json.Unmarshal(bytes, &r); err != nil {
-		return common.Hash{}, errors.Wrap(err, "failed to unmarshal response body")
-	}
-
-	hsh, ok := r.Result.(string)
-	if !ok {
-		fmt.Println("failed to convert result to hash string")
+// StopSequencer implements NodeRPC. It returns the hash of the last sequenced block, or
+// ErrSequencerAlreadyStopped if the sequencer is not running.
+func (n *NodeRPCClient) StopSequencer(ctx context.Context) (common.Hash, error) {
+	var hsh common.Hash
+	if err := call(ctx, n.client, n.metrics, StopSequencerMethod, nil, &hsh); err != nil {
+		return common.Hash{}, classify(err, ErrSequencerAlreadyStopped)
 	}
-	fmt.Printf("Sequencer stopped at %s\n", hsh)
-
-	return common.HexToHash(hsh), nil
+	n.log.Info("sequencer stopped", "head", hsh)
+	return hsh, nil
 }
 
 // SequencerActive implements NodeRPC.
-func (n *NodeRPCClient) SequencerActive() (bool, error) {
-	req := rpc.JSONRPCRequest{
-		Version: rpc.DefaultJsonRPCVersion,
-		Method:  "admin_sequencerActive",
-		Params:  []any{},
-		ID:      0,
-	}
-
-	resp, err := rpc.Post(n.client, n.serverAddr, req)
-	if err != nil {
-		return false, errors.Wrap(err, "failed to send request")
-	}
-
-	bytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return false, errors.Wrap(err, "failed to read response body")
-	}
-
-	var r rpc.JSONRPCResponse
-	if err := json.Unmarshal(bytes, &r); err != nil {
-		fmt.Println(string(bytes))
-		return false, errors.Wrap(err, "failed to unmarshal response body")
-	}
-
-	active, ok := r.Result.(bool)
-	if !ok {
-		return false, errors.New("failed to convert result to bool")
+func (n *NodeRPCClient) SequencerActive(ctx context.Context) (bool, error) {
+	var active bool
+	if err := call(ctx, n.client, n.metrics, SequencerActiveMethod, nil, &active); err != nil {
+		return false, err
 	}
 
 	return active, nil
 }
 
-type MockNodeRPC struct{}
+// MockNodeRPC simulates an op-node whose sequencer starts stopped, and that rejects starts
+// with a fencing token older than the last one it accepted.
+type MockNodeRPC struct {
+	mockErrors
+	log    hclog.Logger
+	active *atomic.Bool
+
+	mu    sync.Mutex
+	token rpc.FencingToken
+}
 
 var _ NodeRPC = (*MockNodeRPC)(nil)
 
-func NewMockNodeRPC() NodeRPC {
-	return &MockNodeRPC{}
+func NewMockNodeRPC(log hclog.Logger) NodeRPC {
+	return &MockNodeRPC{
+		log:    log,
+		active: atomic.NewBool(false),
+	}
 }
 
 // StartSequencer implements NodeRPC.
-func (*MockNodeRPC) StartSequencer(hsh common.Hash) error {
-	log.Info("MockNodeRPC: StartSequencer")
+func (m *MockNodeRPC) StartSequencer(ctx context.Context, hsh common.Hash, token rpc.FencingToken) error {
+	m.log.Info("mock sequencer start", "head", hsh, "token", token, "term", token.Term)
+	if err := m.err(StartSequencerMethod); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if token.Less(m.token) {
+		return ErrStaleFencingToken
+	}
+	m.token = token
+	if !m.active.CompareAndSwap(false, true) {
+		return ErrSequencerAlreadyStarted
+	}
 	return nil
 }
 
 // StopSequencer implements NodeRPC.
-func (*MockNodeRPC) StopSequencer() (common.Hash, error) {
-	log.Info("MockNodeRPC: StopSequencer")
+func (m *MockNodeRPC) StopSequencer(ctx context.Context) (common.Hash, error) {
+	m.log.Info("mock sequencer stop")
+	if err := m.err(StopSequencerMethod); err != nil {
+		return common.Hash{}, err
+	}
+	if !m.active.CompareAndSwap(true, false) {
+		return common.Hash{}, ErrSequencerAlreadyStopped
+	}
 	return common.Hash{}, nil
 }
 
 // SequencerActive implements NodeRPC.
-func (*MockNodeRPC) SequencerActive() (bool, error) {
-	log.Info("MockNodeRPC: SequencerActive")
-	return true, nil
+func (m *MockNodeRPC) SequencerActive(ctx context.Context) (bool, error) {
+	m.log.Debug("mock sequencer status", "active", m.active.Load())
+	if err := m.err(SequencerActiveMethod); err != nil {
+		return false, err
+	}
+	return m.active.Load(), nil
 }
@@ -0,0 +1,176 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/base-org/leader-election/leader/rpc"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/hashicorp/go-hclog"
+)
+
+// request is a call received by a fakeServer.
+type request struct {
+	Method       string
+	Params       []json.RawMessage
+	FencingToken string
+}
+
+// fakeServer answers each JSON-RPC method with a fixed result or error, and records the
+// calls it receives.
+type fakeServer struct {
+	*httptest.Server
+	results map[string]any
+	errors  map[string]*rpc.JSONRPCError
+
+	mu       sync.Mutex
+	requests []request
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	s := &fakeServer{
+		results: make(map[string]any),
+		errors:  make(map[string]*rpc.JSONRPCError),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     uint64            `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		s.requests = append(s.requests, request{Method: req.Method, Params: req.Params, FencingToken: r.Header.Get(rpc.FencingTokenHeader)})
+		s.mu.Unlock()
+
+		resp := rpc.JSONRPCResponse{Version: rpc.DefaultJsonRPCVersion, ID: req.ID, Error: s.errors[req.Method]}
+		if resp.Error == nil {
+			resp.Result, _ = json.Marshal(s.results[req.Method])
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// methods returns the methods called, in order.
+func (s *fakeServer) methods() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	methods := make([]string, 0, len(s.requests))
+	for _, req := range s.requests {
+		methods = append(methods, req.Method)
+	}
+	return methods
+}
+
+func (s *fakeServer) lastRequest(t *testing.T) request {
+	t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.requests) == 0 {
+		t.Fatalf("no request received")
+	}
+	return s.requests[len(s.requests)-1]
+}
+
+func TestStartSequencer(t *testing.T) {
+	head := common.HexToHash("0x01")
+	token := rpc.FencingToken{Term: 4, Index: 9}
+
+	tests := []struct {
+		name    string
+		err     *rpc.JSONRPCError
+		wantErr error
+	}{
+		{name: "started"},
+		{name: "already started", err: &rpc.JSONRPCError{Code: -32000, Message: "sequencer already running"}, wantErr: ErrSequencerAlreadyStarted},
+		{name: "stale token", err: &rpc.JSONRPCError{Code: -32000, Message: "stale fencing token: term 3"}, wantErr: ErrStaleFencingToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newFakeServer(t)
+			if tt.err != nil {
+				srv.errors[StartSequencerMethod] = tt.err
+			}
+			node := NewNodeRPC(srv.URL, rpc.Timeouts{}, hclog.NewNullLogger(), nil)
+
+			err := node.StartSequencer(context.Background(), head, token)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("StartSequencer() = %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("StartSequencer() = %v, want %v", err, tt.wantErr)
+			}
+
+			req := srv.lastRequest(t)
+			if req.FencingToken != token.String() {
+				t.Errorf("%s = %q, want %q", rpc.FencingTokenHeader, req.FencingToken, token.String())
+			}
+			var got common.Hash
+			if len(req.Params) != 1 || json.Unmarshal(req.Params[0], &got) != nil || got != head {
+				t.Errorf("params = %s, want [%s]", req.Params, head)
+			}
+		})
+	}
+}
+
+func TestStopSequencer(t *testing.T) {
+	srv := newFakeServer(t)
+	last := common.HexToHash("0x02")
+	srv.results[StopSequencerMethod] = last
+	node := NewNodeRPC(srv.URL, rpc.Timeouts{}, hclog.NewNullLogger(), nil)
+
+	got, err := node.StopSequencer(context.Background())
+	if err != nil || got != last {
+		t.Fatalf("StopSequencer() = %s, %v, want %s", got, err, last)
+	}
+	// Stopping does not need the leadership, so it is not fenced.
+	if req := srv.lastRequest(t); req.FencingToken != "" {
+		t.Errorf("%s = %q, want none", rpc.FencingTokenHeader, req.FencingToken)
+	}
+
+	srv.errors[StopSequencerMethod] = &rpc.JSONRPCError{Code: -32000, Message: "sequencer not running"}
+	if _, err := node.StopSequencer(context.Background()); !errors.Is(err, ErrSequencerAlreadyStopped) {
+		t.Errorf("StopSequencer() = %v, want %v", err, ErrSequencerAlreadyStopped)
+	}
+}
+
+func TestSequencerActive(t *testing.T) {
+	srv := newFakeServer(t)
+	srv.results[SequencerActiveMethod] = true
+	node := NewNodeRPC(srv.URL, rpc.Timeouts{}, hclog.NewNullLogger(), nil)
+
+	active, err := node.SequencerActive(context.Background())
+	if err != nil || !active {
+		t.Fatalf("SequencerActive() = %t, %v, want true", active, err)
+	}
+
+	srv.Close()
+	if _, err := node.SequencerActive(context.Background()); !rpc.IsUnavailable(err) {
+		t.Errorf("SequencerActive() = %v, want an unavailable error", err)
+	}
+}
+
+func TestMockNodeRPCFencing(t *testing.T) {
+	node := NewMockNodeRPC(hclog.NewNullLogger())
+	ctx := context.Background()
+
+	if err := node.StartSequencer(ctx, common.Hash{}, rpc.FencingToken{Term: 2, Index: 1}); err != nil {
+		t.Fatalf("StartSequencer() = %v", err)
+	}
+	if _, err := node.StopSequencer(ctx); err != nil {
+		t.Fatalf("StopSequencer() = %v", err)
+	}
+	if err := node.StartSequencer(ctx, common.Hash{}, rpc.FencingToken{Term: 1, Index: 5}); !errors.Is(err, ErrStaleFencingToken) {
+		t.Errorf("StartSequencer() = %v, want %v", err, ErrStaleFencingToken)
+	}
+}
@@ -3,20 +3,32 @@ package leader
 import (
 	"context"
 	"fmt"
-	"log"
+	"io"
 	"net"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	transport "github.com/Jille/raft-grpc-transport"
 	"github.com/Jille/raftadmin"
+	"github.com/base-org/leader-election/leader/audit"
+	"github.com/base-org/leader-election/leader/cluster"
 	"github.com/base-org/leader-election/leader/config"
 	"github.com/base-org/leader-election/leader/control"
+	"github.com/base-org/leader-election/leader/fsm"
 	lh "github.com/base-org/leader-election/leader/health"
+	"github.com/base-org/leader-election/leader/metrics"
+	"github.com/base-org/leader-election/leader/rpc"
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/raft"
 	boltdb "github.com/hashicorp/raft-boltdb"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/atomic"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
@@ -25,6 +37,25 @@ import (
 	"google.golang.org/grpc/reflection"
 )
 
+const (
+	// barrierTimeout bounds how long a new leader waits to apply all committed logs to the FSM.
+	barrierTimeout = 10 * time.Second
+	// applyTimeout bounds how long the leader waits to commit an unsafe head.
+	applyTimeout = 2 * time.Second
+	// membershipTimeout bounds a change of the raft configuration.
+	membershipTimeout = 5 * time.Second
+	// reportHealthTimeout bounds sending the local health to the other nodes.
+	reportHealthTimeout = 1 * time.Second
+	// peerStatusMaxAge is how many health intervals a peer status stays relevant.
+	peerStatusMaxAge = 3
+	// reconcileInterval is how often the sequencer state machine is stepped without events.
+	reconcileInterval = 1 * time.Second
+	// maxRetries is how many consecutive failed steps the state machine tolerates.
+	maxRetries = 3
+	// grpcStopTimeout bounds how long in-flight gRPC calls may finish on shutdown.
+	grpcStopTimeout = 2 * time.Second
+)
+
 type Elector struct {
 	log           hclog.Logger
 	config        *config.Config
@@ -33,81 +64,317 @@ type Elector struct {
 	stableStore   raft.StableStore
 	snapshotStore raft.SnapshotStore
 	transport     raft.Transport
+	fsm           *fsm.UnsafeHeadFSM
 	leader        *atomic.Bool
 	leaderCh      <-chan bool
+	leaderUpdate  chan struct{}
+	leaderSince   *atomic.Time
+	// leaseExpired is set while the leader could not confirm it reaches a quorum, see watchLease.
+	leaseExpired *atomic.Bool
+	// leaderMu serializes the leadership updates sent to the state machine.
+	leaderMu sync.Mutex
+	// lastTransfer is the time of the last health-driven leadership transfer.
+	lastTransfer time.Time
+	// health is the last local health report, served by the status API.
+	healthMu sync.RWMutex
+	health   *lh.HealthReport
+
+	consensus *raftConsensus
+	sm        *StateMachine
 
 	// TODO: clean up later when we switch off from raft-grpc-transport lib
 	tm *transport.Manager
 
-	monitor    lh.HealthMonitor
-	batcherRPC control.BatcherRPC
-	nodeRPC    control.NodeRPC
-	gethRPC    control.GethRPC
+	monitor       lh.HealthMonitor
+	peers         *cluster.Registry
+	clusterClient *cluster.Client
+	batcherRPC    control.BatcherRPC
+	nodeRPC       control.NodeRPC
+	gethRPC       control.GethRPC
+	metrics       *metrics.Metrics
+	audit         *audit.Log
 }
 
 func NewElector(ctx context.Context, cfg *config.Config) (*Elector, error) {
+	var m *metrics.Metrics
+	if cfg.Metrics.Enabled {
+		var err error
+		if m, err = metrics.New(stateNames()); err != nil {
+			return nil, err
+		}
+	}
+
+	auditLog, err := audit.Open(cfg.StorageDir, string(cfg.RaftConfig.LocalID), cfg.Audit.MaxSize, cfg.Audit.MaxBackups, cfg.Logger.Named("audit"))
+	if err != nil {
+		return nil, err
+	}
+
 	var batcherRPC control.BatcherRPC
 	var nodeRPC control.NodeRPC
 	var gethRPC control.GethRPC
-	var monitor lh.HealthMonitor
 	// Run mock clients if in test mode.
 	if cfg.Test {
-		batcherRPC = control.NewMockBatcherRPC()
-		nodeRPC = control.NewMockNodeRPC()
+		batcherRPC = control.NewMockBatcherRPC(cfg.Logger.Named(lh.ComponentBatcher))
+		nodeRPC = control.NewMockNodeRPC(cfg.Logger.Named(lh.ComponentNode))
 		gethRPC = control.NewMockGethRPC()
-		monitor = lh.NewMockHealthMonitor(cfg.HealthCheckPath)
 	} else {
-		batcherRPC = control.NewBatcherRPC(cfg.BatcherAddr)
-		nodeRPC = control.NewNodeRPC(cfg.NodeAddr)
-		gethRPC = control.NewGethRPC(cfg.GethAddr)
-		monitor = lh.NewSimpleHealthMonitor(cfg)
+		batcherRPC = control.NewBatcherRPC(cfg.BatcherAddr, cfg.RPCTimeouts, cfg.Logger.Named(lh.ComponentBatcher), m)
+		nodeRPC = control.NewNodeRPC(cfg.NodeAddr, cfg.RPCTimeouts, cfg.Logger.Named(lh.ComponentNode), m)
+		gethRPC = control.NewGethRPC(cfg.GethAddr, cfg.RPCTimeouts, cfg.Logger.Named(lh.ComponentGeth), m)
 	}
 
 	e := &Elector{
-		log:        cfg.RaftConfig.Logger,
-		config:     cfg,
-		leader:     atomic.NewBool(false),
-		monitor:    monitor,
-		batcherRPC: batcherRPC,
-		nodeRPC:    nodeRPC,
-		gethRPC:    gethRPC,
+		log:           cfg.Logger.Named("elector"),
+		config:        cfg,
+		leader:        atomic.NewBool(false),
+		leaderUpdate:  make(chan struct{}, 1),
+		leaderSince:   atomic.NewTime(time.Time{}),
+		leaseExpired:  atomic.NewBool(false),
+		fsm:           fsm.New(),
+		peers:         cluster.NewRegistry(),
+		clusterClient: cluster.NewClient(),
+		batcherRPC:    batcherRPC,
+		nodeRPC:       nodeRPC,
+		gethRPC:       gethRPC,
+		metrics:       m,
+		audit:         auditLog,
 	}
 
 	if err := e.makeRaft(ctx); err != nil {
+		auditLog.Close()
 		return nil, err
 	}
 
+	e.consensus = &raftConsensus{
+		log:              e.log,
+		raft:             e.raft,
+		fsm:              e.fsm,
+		localID:          cfg.RaftConfig.LocalID,
+		peers:            e.peers,
+		peerStatusMaxAge: peerStatusMaxAge * cfg.Health.Interval,
+	}
+	e.sm = NewStateMachine(
+		StateMachineConfig{
+			CatchUpTimeout: cfg.CatchUpTimeout,
+			MaxRetries:     maxRetries,
+		},
+		e.consensus,
+		nodeRPC,
+		batcherRPC,
+		gethRPC,
+		cfg.Logger.Named("sequencer"),
+		m,
+		auditLog,
+	)
+
+	if cfg.Test {
+		e.monitor = lh.NewMockHealthMonitor(ctx, cfg.HealthCheckPath, cfg.Health, cfg.Logger.Named("health"))
+	} else {
+		e.monitor = lh.NewSimpleHealthMonitor(ctx, cfg, e.sequencing, cfg.Logger.Named("health"))
+	}
+
 	return e, nil
 }
 
-func (e *Elector) Run(ctx context.Context) {
-	// go e.monitorLeadership(ctx)
-	// go e.monitorSequencerHealth(ctx)
-	go e.run(ctx)
+// State returns the current state of the local sequencer.
+func (e *Elector) State() State {
+	return e.sm.State()
+}
+
+// sequencing returns true if the local sequencer is supposed to produce blocks.
+func (e *Elector) sequencing() bool {
+	return e.sm.State() == StateLeading
+}
+
+// SequencingPaused implements cluster.Sequencing.
+func (e *Elector) SequencingPaused() bool {
+	return e.consensus.SequencingPaused()
+}
+
+// SetSequencingPaused implements cluster.Sequencing. Sequencing stays paused across
+// leadership changes until it is resumed, it only succeeds on the leader.
+func (e *Elector) SetSequencingPaused(paused bool) error {
+	cmd, err := fsm.NewSetSequencingPaused(paused)
+	if err != nil {
+		return err
+	}
+	err = e.consensus.apply(cmd)
+	e.audit.Record(audit.Entry{
+		Term:   e.consensus.Term(),
+		Event:  audit.EventPause,
+		Reason: audit.ReasonOperator,
+		Params: map[string]string{"paused": strconv.FormatBool(paused)},
+		Result: audit.Result(err),
+	})
+	if err != nil {
+		return err
+	}
+	e.log.Info("sequencing paused changed", "paused", paused, "term", e.consensus.Term())
+	e.notifyLeaderUpdate()
+	return nil
+}
+
+// Run serves the raft transport, the admin and cluster services, and reconciles the local
+// sequencer with the raft leadership until ctx is cancelled or serving fails. It then shuts
+// down gracefully, see shutdown.
+func (e *Elector) Run(ctx context.Context) error {
+	_, port, err := net.SplitHostPort(e.config.ServerAddr)
+	if err != nil {
+		return errors.Wrap(err, "failed to split host port")
+	}
+	sock, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
+	if err != nil {
+		return errors.Wrap(err, "failed to listen")
+	}
 
 	s := grpc.NewServer()
 	e.tm.Register(s)
 	raftadmin.Register(s, e.raft)
+	cluster.NewServer(e.peers, e, e, e, e.audit).Register(s)
 	reflection.Register(s)
 	hs := health.NewServer()
 	grpc_health_v1.RegisterHealthServer(s, hs)
 
-	_, port, err := net.SplitHostPort(e.config.ServerAddr)
-	if err != nil {
-		log.Fatalf("failed to split host port: %v", err)
+	loopCtx, cancelLoops := context.WithCancel(ctx)
+	defer cancelLoops()
+	var loops sync.WaitGroup
+	loops.Add(4)
+	go func() {
+		defer loops.Done()
+		e.watchLeadership(loopCtx)
+	}()
+	go func() {
+		defer loops.Done()
+		e.watchLease(loopCtx)
+	}()
+	go func() {
+		defer loops.Done()
+		e.run(loopCtx)
+	}()
+	go func() {
+		defer loops.Done()
+		e.reportHealth(loopCtx)
+	}()
+	if e.metrics != nil {
+		go func() {
+			if err := e.metrics.Serve(loopCtx, e.config.Metrics.Addr); err != nil {
+				e.log.Error("metrics server stopped", "err", err)
+			}
+		}()
 	}
-	sock, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
-	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
+	if e.config.Status.Enabled {
+		go func() {
+			if err := e.serveStatus(loopCtx, e.config.Status.Addr); err != nil {
+				e.log.Error("status server stopped", "err", err)
+			}
+		}()
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- s.Serve(sock)
+	}()
+
+	select {
+	case <-ctx.Done():
+		e.log.Info("received shutdown signal, shutting down")
+	case err = <-serveErr:
+		err = errors.Wrap(err, "failed to serve")
+		e.log.Error("shutting down", "err", err)
+	}
+	cancelLoops()
+
+	if serr := e.shutdown(s, &loops); serr != nil {
+		if err != nil {
+			e.log.Error("shutdown failed", "err", serr)
+			return err
+		}
+		return serr
 	}
-	if err = s.Serve(sock); err != nil {
-		log.Fatalf("failed to serve: %v", err)
+	return err
+}
+
+// shutdown waits for the reconciliation loops to exit, then stops the local batcher and
+// sequencer before handing leadership over, so that two sequencers never run at once. It
+// then shuts down raft and the gRPC server, and closes the stores. It gives up after the
+// configured shutdown timeout.
+func (e *Elector) shutdown(s *grpc.Server, loops *sync.WaitGroup) error {
+	ctx, cancel := context.WithTimeout(context.Background(), e.config.ShutdownTimeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- e.stop(ctx, s, loops)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		s.Stop()
+		return errors.Errorf("shutdown did not complete within %s", e.config.ShutdownTimeout)
 	}
 }
 
-func (e *Elector) makeRaft(ctx context.Context) error {
-	log := e.config.RaftConfig.Logger
+func (e *Elector) stop(ctx context.Context, s *grpc.Server, loops *sync.WaitGroup) error {
+	var errs []error
+	loops.Wait()
 
+	if err := e.sm.Shutdown(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	if e.raft.State() == raft.Leader && e.hasOtherVoters() {
+		e.log.Info("handing leadership over before shutting down", "term", e.consensus.Term())
+		e.metrics.RecordLeadershipTransfer(metrics.TransferShutdown)
+		// The other nodes elect a leader on their own if this fails, e.g. when they are
+		// shutting down too.
+		if err := e.transferLeadership(ctx, audit.ReasonShutdown, metrics.TransferShutdown); err != nil {
+			e.log.Warn("failed to hand leadership over", "err", err)
+		}
+	}
+	if err := e.raft.Shutdown().Error(); err != nil {
+		errs = append(errs, errors.Wrap(err, "failed to shut down raft"))
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(grpcStopTimeout):
+		// Streams opened by the other nodes are not closed by GracefulStop.
+		s.Stop()
+	}
+
+	if err := e.tm.Close(); err != nil {
+		errs = append(errs, errors.Wrap(err, "failed to close raft transport"))
+	}
+	e.monitor.Close()
+	e.clusterClient.Close()
+	for _, store := range []any{e.logStore, e.stableStore} {
+		if c, ok := store.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				errs = append(errs, errors.Wrap(err, "failed to close store"))
+			}
+		}
+	}
+	if err := e.audit.Close(); err != nil {
+		errs = append(errs, errors.Wrap(err, "failed to close audit log"))
+	}
+
+	if len(errs) == 0 {
+		e.log.Info("shutdown complete")
+		return nil
+	}
+	for _, err := range errs[1:] {
+		e.log.Error("shutdown error", "err", err)
+	}
+	return errs[0]
+}
+
+func (e *Elector) makeRaft(ctx context.Context) error {
 	if _, err := os.Stat(e.config.StorageDir); os.IsNotExist(err) {
 		if err := os.MkdirAll(e.config.StorageDir, 0755); err != nil {
 			return fmt.Errorf("error creating storage dir: %v", err)
@@ -115,17 +382,17 @@ func (e *Elector) makeRaft(ctx context.Context) error {
 	}
 
 	var err error
-	e.logStore, err = boltdb.NewBoltStore(filepath.Join(e.config.StorageDir, "logs.dat"))
+	e.logStore, err = boltdb.NewBoltStore(filepath.Join(e.config.StorageDir, config.LogStoreFile))
 	if err != nil {
-		return fmt.Errorf(`boltdb.NewBoltStore(%q): %v`, filepath.Join(e.config.StorageDir, "logs.dat"), err)
+		return fmt.Errorf(`boltdb.NewBoltStore(%q): %v`, filepath.Join(e.config.StorageDir, config.LogStoreFile), err)
 	}
 
-	e.stableStore, err = boltdb.NewBoltStore(filepath.Join(e.config.StorageDir, "stable.dat"))
+	e.stableStore, err = boltdb.NewBoltStore(filepath.Join(e.config.StorageDir, config.StableStoreFile))
 	if err != nil {
-		return fmt.Errorf(`boltdb.NewBoltStore(%q): %v`, filepath.Join(e.config.StorageDir, "stable.dat"), err)
+		return fmt.Errorf(`boltdb.NewBoltStore(%q): %v`, filepath.Join(e.config.StorageDir, config.StableStoreFile), err)
 	}
 
-	e.snapshotStore, err = raft.NewFileSnapshotStoreWithLogger(e.config.StorageDir, e.config.SnapshotLimit, log)
+	e.snapshotStore, err = raft.NewFileSnapshotStoreWithLogger(e.config.StorageDir, e.config.SnapshotLimit, e.config.RaftConfig.Logger)
 	if err != nil {
 		return fmt.Errorf(`raft.NewFileSnapshotStore(%q, ...): %v`, e.config.StorageDir, err)
 	}
@@ -133,7 +400,7 @@ func (e *Elector) makeRaft(ctx context.Context) error {
 	e.tm = transport.New(raft.ServerAddress(e.config.ServerAddr), []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())})
 	e.transport = e.tm.Transport()
 
-	e.raft, err = raft.NewRaft(e.config.RaftConfig, nil, e.logStore, e.stableStore, e.snapshotStore, e.transport)
+	e.raft, err = raft.NewRaft(e.config.RaftConfig, e.fsm, e.logStore, e.stableStore, e.snapshotStore, e.transport)
 	if err != nil {
 		return fmt.Errorf("raft.NewRaft: %v", err)
 	}
@@ -161,128 +428,285 @@ func (e *Elector) makeRaft(ctx context.Context) error {
 
 func (e *Elector) run(ctx context.Context) {
 	healthCh := e.monitor.Subscribe()
+	defer e.monitor.Unsubscribe(healthCh)
+	ticker := time.NewTicker(reconcileInterval)
+	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case leader := <-e.leaderCh:
-			// Handle leadership change
-			fmt.Printf("leader election occured, leader status is now: %t\n", leader)
-			e.leader.Store(leader)
-
-			if leader {
-				fmt.Printf("Starting sequencer at %s\n", e.config.ServerAddr)
-				// Start sequencer when changing to leader
-				current, err := e.gethRPC.LatestBlock()
-				if err != nil {
-					fmt.Println(err)
-				}
-				e.nodeRPC.StartSequencer(current)
-				e.batcherRPC.StartBatcher()
-			} else {
-				fmt.Printf("Stopping sequencer at %s\n", e.config.ServerAddr)
-				// Stop sequencer when stepping down from leader
-				e.batcherRPC.StopBatcher()
-				e.nodeRPC.StopSequencer()
+		case <-e.leaderUpdate:
+			e.stepLeaderUpdate(ctx)
+		case report, ok := <-healthCh:
+			if !ok {
+				e.log.Warn("health monitor closed, no longer watching sequencer health")
+				healthCh = nil
+				continue
 			}
-		case healthy := <-healthCh:
-			fmt.Println("received health update", healthy)
-			if healthy {
+			e.log.Debug("received health update", "healthy", report.Healthy, "report", report.String())
+			if report.Healthy {
 				continue
 			}
+			e.handleUnhealthy(ctx, report)
+		case <-ticker.C:
+			e.sm.Step(ctx)
+			e.recordRaft()
+		}
+	}
+}
 
-			// TODO: make it more robust, handle error better
-			fmt.Println("sequencer is unhealthy, trying to transfer leadership to another node")
-			if err := e.raft.LeadershipTransfer().Error(); err != nil {
-				fmt.Println("failed to transfer leadership", err)
-			}
-		default:
-			leader := e.leader.Load()
-			seqActive, err := e.nodeRPC.SequencerActive()
-			if err != nil {
-				fmt.Println("failed to get sequencer status", err)
-			}
+// stepLeaderUpdate steps the state machine after a change of the leadership, the lease or
+// the sequencing pause, in a span the state machine transitions it causes belong to.
+func (e *Elector) stepLeaderUpdate(ctx context.Context) {
+	ctx, span := tracer.Start(ctx, "leadership update", trace.WithAttributes(
+		attribute.Bool("leader", e.leader.Load()),
+		attribute.Bool("lease_expired", e.leaseExpired.Load()),
+		attribute.Bool("sequencing_paused", e.consensus.SequencingPaused()),
+		attribute.Int64("term", int64(e.consensus.Term())),
+	))
+	defer span.End()
+
+	e.sm.Step(ctx)
+	span.SetAttributes(attribute.String("state", e.sm.State().String()))
+}
 
-			if leader && !seqActive {
-				fmt.Printf("Starting sequencer at %s\n", e.config.ServerAddr)
-				// Start sequencer when changing to leader
-				current, err := e.gethRPC.LatestBlock()
-				if err != nil {
-					fmt.Println(err)
-				}
-				e.nodeRPC.StartSequencer(current)
-				e.batcherRPC.StartBatcher()
-			} else if !leader && seqActive {
-				fmt.Printf("Stopping sequencer at %s\n", e.config.ServerAddr)
-				// Stop sequencer when stepping down from leader
-				e.batcherRPC.StopBatcher()
-				e.nodeRPC.StopSequencer()
-			} else {
-				// do nothing...
-				fmt.Println("sequencer in correct state")
-			}
+// handleUnhealthy transfers leadership away from an unhealthy leader, unless it was only
+// just elected or leadership was already transferred for health reasons recently. A failing
+// op-batcher alone does not move the sequencer, see HealthReport.CanSequence.
+func (e *Elector) handleUnhealthy(ctx context.Context, report lh.HealthReport) {
+	if !e.leader.Load() {
+		return
+	}
 
-			time.Sleep(1 * time.Second)
-			// // need to add locks to avoid race condition here.
-			// if e.leader.Load() {
+	if report.CanSequence() {
+		e.log.Warn("op-batcher is unhealthy, not transferring leadership for a batcher-only failure")
+		return
+	}
 
-			// } else {
-			// 	fmt.Printf("Stopping sequencer at %s\n", e.config.ServerAddr)
-			// 	// Stop sequencer when stepping down from leader
-			// 	e.batcherRPC.StopBatcher()
-			// 	e.nodeRPC.StopSequencer()
-			// }
-		}
+	if elected := time.Since(e.leaderSince.Load()); elected < e.config.Health.GracePeriod {
+		e.log.Warn("sequencer is unhealthy but leader is within grace period", "elected", elected.Truncate(time.Second), "unhealthy", report.Unhealthy())
+		return
+	}
+	if last := time.Since(e.lastTransfer); last < e.config.Health.MinTransferInterval {
+		e.log.Warn("sequencer is unhealthy but leadership was transferred recently, not transferring again", "transferred", last.Truncate(time.Second), "unhealthy", report.Unhealthy())
+		return
+	}
 
+	e.log.Warn("sequencer is unhealthy, trying to transfer leadership to another node", "term", e.consensus.Term(), "unhealthy", report.Unhealthy())
+	e.lastTransfer = time.Now()
+	e.metrics.RecordLeadershipTransfer(metrics.TransferUnhealthy)
+	if err := e.transferLeadership(ctx, audit.ReasonHealth, metrics.TransferUnhealthy, report.Unhealthy()...); err != nil {
+		e.log.Error("failed to transfer leadership", "err", err)
 	}
 }
 
-func (e *Elector) monitorLeadership(ctx context.Context) {
+// reportHealth records every local health report, along with the local op-geth head, and
+// gossips it to every other node of the cluster. The leader uses it to pick a healthy node
+// when it has to transfer leadership and to demote the unhealthy ones, and any node can
+// serve the cluster-wide view.
+func (e *Elector) reportHealth(ctx context.Context) {
+	ch := e.monitor.Subscribe()
+	defer e.monitor.Unsubscribe(ch)
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case leader := <-e.leaderCh:
-			fmt.Println("leader election occured", leader)
-			e.leader.Store(leader)
-
-			// TODO: handle error situation
-			if leader {
-				fmt.Printf("Starting sequencer at %s\n", e.config.ServerAddr)
-				// Start sequencer when changing to leader
-				current, _ := e.gethRPC.LatestBlock()
-				e.nodeRPC.StartSequencer(current)
-				e.batcherRPC.StartBatcher()
-			} else {
-				fmt.Printf("Stopping sequencer at %s\n", e.config.ServerAddr)
-				// Stop sequencer when stepping down from leader
-				e.batcherRPC.StopBatcher()
-				e.nodeRPC.StopSequencer()
+		case report, ok := <-ch:
+			if !ok {
+				return
+			}
+			e.setLastHealth(report)
+			for _, c := range report.Components {
+				e.metrics.RecordComponentHealth(c.Name, c.Healthy, c.Latency)
+			}
+			e.publishHealth(ctx, report)
+			if e.leader.Load() {
+				e.reconcileMembership()
 			}
 		}
 	}
 }
 
-func (e *Elector) monitorSequencerHealth(ctx context.Context) {
-	healthUpdate := e.monitor.Subscribe()
-	fmt.Println("Started to monitor sequencer health")
+func (e *Elector) publishHealth(ctx context.Context, report lh.HealthReport) {
+	status := cluster.PeerStatus{
+		ID:      string(e.config.RaftConfig.LocalID),
+		Address: e.config.ServerAddr,
+		Report:  report,
+	}
+	if head, err := e.gethRPC.LatestBlock(ctx); err != nil {
+		e.log.Warn("failed to get latest block for health report", "err", err)
+	} else {
+		status.Head = rpc.BlockID{Hash: head.Hash, Number: head.Number}
+	}
+	e.peers.Update(status)
+
+	future := e.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		e.log.Warn("failed to get raft configuration", "err", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, reportHealthTimeout)
+	defer cancel()
 
+	var wg sync.WaitGroup
+	for _, srv := range future.Configuration().Servers {
+		if srv.ID == e.config.RaftConfig.LocalID {
+			continue
+		}
+		wg.Add(1)
+		go func(srv raft.Server) {
+			defer wg.Done()
+			if err := e.clusterClient.ReportHealth(ctx, string(srv.Address), status); err != nil {
+				e.log.Debug("failed to report health", "peer", srv.ID, "err", err)
+			}
+		}(srv)
+	}
+	wg.Wait()
+}
+
+// watchLeadership forwards raft leadership changes to the state machine as soon as they
+// happen, so that losing leadership cancels in-flight calls even while the state machine
+// is busy, and then wakes up the reconciliation loop.
+func (e *Elector) watchLeadership(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case healthy := <-healthUpdate:
-			fmt.Println("received health update", healthy)
-			if healthy {
-				continue
+		case leader := <-e.leaderCh:
+			e.log.Info("leadership changed", "leader", leader, "term", e.consensus.Term())
+			if leader {
+				e.leaderSince.Store(time.Now())
+				e.leaseExpired.Store(false)
 			}
+			e.leader.Store(leader)
+			e.metrics.RecordLeader(leader)
+			e.audit.Record(audit.Entry{
+				Term:   e.consensus.Term(),
+				Event:  audit.EventLeadership,
+				Reason: audit.ReasonElection,
+				Params: map[string]string{"leader": strconv.FormatBool(leader)},
+			})
+			e.syncLeader()
+		}
+	}
+}
 
-			// TODO: make it more robust, handle error better
-			fmt.Println("sequencer is unhealthy, trying to transfer leadership to another node")
-			if err := e.raft.LeadershipTransfer().Error(); err != nil {
-				fmt.Println("failed to transfer leadership", err)
-			}
+// TransferLeadership implements cluster.Leadership. It hands leadership over on behalf of an
+// operator, to the server with the given ID, or to the healthiest peer if it is empty.
+func (e *Elector) TransferLeadership(ctx context.Context, to string) error {
+	if e.raft.State() != raft.Leader {
+		return raft.ErrNotLeader
+	}
+	e.metrics.RecordLeadershipTransfer(metrics.TransferOperator)
+	return e.transferLeadershipTo(ctx, raft.ServerID(to), audit.ReasonOperator, metrics.TransferOperator)
+}
+
+// transferLeadership hands leadership over and records it in the audit log, along with the
+// unhealthy components that caused it, if any.
+func (e *Elector) transferLeadership(ctx context.Context, reason, cause string, unhealthy ...string) error {
+	return e.transferLeadershipTo(ctx, "", reason, cause, unhealthy...)
+}
+
+// transferLeadershipTo is transferLeadership to the given server, or to the healthiest peer
+// if it is empty.
+func (e *Elector) transferLeadershipTo(ctx context.Context, to raft.ServerID, reason, cause string, unhealthy ...string) error {
+	term := e.consensus.Term()
+	_, span := tracer.Start(ctx, "leadership transfer", trace.WithAttributes(
+		attribute.String("reason", reason),
+		attribute.String("cause", cause),
+		attribute.String("target", string(to)),
+		attribute.StringSlice("unhealthy", unhealthy),
+		attribute.Int64("term", int64(term)),
+	))
+	defer span.End()
+
+	var err error
+	if to != "" {
+		err = e.consensus.transferLeadershipTo(to)
+	} else {
+		// Only a health-driven transfer needs a healthy target, moving leadership to a node
+		// that is just as broken would not help.
+		err = e.consensus.transferLeadership(cause == metrics.TransferUnhealthy)
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	params := map[string]string{"cause": cause}
+	if to != "" {
+		params["target"] = string(to)
+	}
+	if len(unhealthy) > 0 {
+		params["unhealthy"] = strings.Join(unhealthy, ",")
+	}
+	e.audit.Record(audit.Entry{
+		Term:   term,
+		Event:  audit.EventTransfer,
+		Reason: reason,
+		Params: params,
+		Result: audit.Result(err),
+	})
+	return err
+}
+
+// recordRaft records the raft term, indexes and last contact with the leader.
+func (e *Elector) recordRaft() {
+	if e.metrics == nil {
+		return
+	}
+	stats := e.raft.Stats()
+	term, _ := strconv.ParseUint(stats["term"], 10, 64)
+	commitIndex, _ := strconv.ParseUint(stats["commit_index"], 10, 64)
+	var lastContact time.Duration
+	if e.raft.State() != raft.Leader {
+		if t := e.raft.LastContact(); !t.IsZero() {
+			lastContact = time.Since(t)
 		}
 	}
+	e.metrics.RecordRaft(term, commitIndex, e.raft.AppliedIndex(), lastContact)
+}
+
+// Servers implements cluster.Members.
+func (e *Elector) Servers() ([]raft.Server, error) {
+	future := e.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return nil, errors.Wrap(err, "failed to get raft configuration")
+	}
+	return future.Configuration().Servers, nil
+}
+
+// hasOtherVoters returns true if another node of the cluster can take over leadership.
+func (e *Elector) hasOtherVoters() bool {
+	future := e.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		e.log.Warn("failed to get raft configuration", "err", err)
+		return false
+	}
+	for _, srv := range future.Configuration().Servers {
+		if srv.ID != e.config.RaftConfig.LocalID && srv.Suffrage == raft.Voter {
+			return true
+		}
+	}
+	return false
+}
+
+// syncLeader tells the state machine it may act as leader only if raft considers the node
+// leader and its lease did not expire, and wakes up the reconciliation loop.
+func (e *Elector) syncLeader() {
+	e.leaderMu.Lock()
+	defer e.leaderMu.Unlock()
+
+	e.sm.SetLeader(e.leader.Load() && !e.leaseExpired.Load())
+	e.notifyLeaderUpdate()
+}
+
+// notifyLeaderUpdate wakes up the reconciliation loop without blocking.
+func (e *Elector) notifyLeaderUpdate() {
+	select {
+	case e.leaderUpdate <- struct{}{}:
+	default:
+	}
 }
@@ -0,0 +1,91 @@
+package flags
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+// ApplyConfigFile sets the flags from the TOML file given with --config, if any. Keys are
+// named after the flags, and a table prefixes the keys it holds, e.g. interval in a [health]
+// table sets --health-interval. Flags and env vars set explicitly take precedence over the
+// file. All unknown keys and invalid values are reported at once.
+func ApplyConfigFile(ctx *cli.Context) error {
+	path := ctx.String(ConfigFile.Name)
+	if path == "" {
+		return nil
+	}
+
+	var raw map[string]any
+	if _, err := toml.DecodeFile(path, &raw); err != nil {
+		var perr toml.ParseError
+		if errors.As(err, &perr) {
+			return fmt.Errorf("failed to parse config file %s:\n%s", path, perr.ErrorWithPosition())
+		}
+		return errors.Wrapf(err, "failed to read config file %s", path)
+	}
+
+	values := make(map[string]any)
+	flatten("", raw, values)
+
+	known := make(map[string]bool, len(Flags))
+	for _, f := range Flags {
+		known[f.GetName()] = true
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var problems []string
+	for _, key := range keys {
+		if !known[key] {
+			problems = append(problems, fmt.Sprintf("unknown key %q", key))
+			continue
+		}
+		if ctx.IsSet(key) {
+			continue
+		}
+		for _, v := range flagValues(values[key]) {
+			if err := ctx.Set(key, v); err != nil {
+				problems = append(problems, fmt.Sprintf("invalid value %q for %q: %v", v, key, err))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid config file %s:\n  %s", path, strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// flatten joins the keys of nested tables with a dash.
+func flatten(prefix string, table map[string]any, values map[string]any) {
+	for key, v := range table {
+		if prefix != "" {
+			key = prefix + "-" + key
+		}
+		if sub, ok := v.(map[string]any); ok {
+			flatten(key, sub, values)
+			continue
+		}
+		values[key] = v
+	}
+}
+
+// flagValues formats a TOML value as flag values, an array sets a slice flag once per item.
+func flagValues(v any) []string {
+	if items, ok := v.([]any); ok {
+		values := make([]string, 0, len(items))
+		for _, item := range items {
+			values = append(values, fmt.Sprint(item))
+		}
+		return values
+	}
+	return []string{fmt.Sprint(v)}
+}
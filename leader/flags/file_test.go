@@ -0,0 +1,125 @@
+package flags
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// runWithConfig runs an app declaring Flags with args and a config file holding content,
+// and returns the context once the config file is applied.
+func runWithConfig(t *testing.T, content string, args ...string) (*cli.Context, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	var (
+		got      *cli.Context
+		applyErr error
+	)
+	app := cli.NewApp()
+	app.Flags = Flags
+	app.Action = func(ctx *cli.Context) error {
+		got, applyErr = ctx, ApplyConfigFile(ctx)
+		return nil
+	}
+	if err := app.Run(append([]string{"leader", "--config", path}, args...)); err != nil {
+		t.Fatalf("failed to run app: %v", err)
+	}
+	return got, applyErr
+}
+
+func TestApplyConfigFile(t *testing.T) {
+	ctx, err := runWithConfig(t, `
+server-id = "node-1"
+bootstrap = true
+rpc-method-timeout = ["optimism_syncStatus=1s", "admin_startSequencer=3s"]
+
+[health]
+interval = "5s"
+max-l1-origin-lag = 20
+`, "--server-id", "node-2")
+	if err != nil {
+		t.Fatalf("ApplyConfigFile() = %v", err)
+	}
+
+	if got := ctx.String(ServerID.Name); got != "node-2" {
+		t.Errorf("%s = %q, want the flag to take precedence", ServerID.Name, got)
+	}
+	if !ctx.Bool(Bootstrap.Name) {
+		t.Errorf("%s = false, want true", Bootstrap.Name)
+	}
+	if got := ctx.Duration(HealthInterval.Name); got != 5*time.Second {
+		t.Errorf("%s = %s, want 5s", HealthInterval.Name, got)
+	}
+	if got := ctx.Uint64(HealthMaxL1OriginLag.Name); got != 20 {
+		t.Errorf("%s = %d, want 20", HealthMaxL1OriginLag.Name, got)
+	}
+	want := []string{"optimism_syncStatus=1s", "admin_startSequencer=3s"}
+	if got := ctx.StringSlice(RPCMethodTimeouts.Name); !reflect.DeepEqual(got, want) {
+		t.Errorf("%s = %v, want %v", RPCMethodTimeouts.Name, got, want)
+	}
+}
+
+func TestApplyConfigFileEnvPrecedence(t *testing.T) {
+	t.Setenv("SERVER_ID", "from-env")
+	ctx, err := runWithConfig(t, `server-id = "from-file"`)
+	if err != nil {
+		t.Fatalf("ApplyConfigFile() = %v", err)
+	}
+	if got := ctx.String(ServerID.Name); got != "from-env" {
+		t.Errorf("%s = %q, want the env var to take precedence", ServerID.Name, got)
+	}
+}
+
+func TestApplyConfigFileReportsAllProblems(t *testing.T) {
+	_, err := runWithConfig(t, `
+server-idd = "node-1"
+snapshot-limit = "many"
+
+[health]
+interval = "often"
+`)
+	if err == nil {
+		t.Fatalf("ApplyConfigFile() = nil, want an error")
+	}
+	for _, want := range []string{`unknown key "server-idd"`, `"snapshot-limit"`, `"health-interval"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("ApplyConfigFile() = %q, want it to report %s", err, want)
+		}
+	}
+}
+
+func TestApplyConfigFileParseError(t *testing.T) {
+	_, err := runWithConfig(t, "server-id = \n")
+	if err == nil || !strings.Contains(err.Error(), "failed to parse config file") {
+		t.Fatalf("ApplyConfigFile() = %v, want a parse error", err)
+	}
+}
+
+func TestFlatten(t *testing.T) {
+	values := make(map[string]any)
+	flatten("", map[string]any{
+		"server-id": "a",
+		"health": map[string]any{
+			"interval": "1s",
+			"max":      map[string]any{"block-age": "10s"},
+		},
+	}, values)
+
+	want := map[string]any{
+		"server-id":            "a",
+		"health-interval":      "1s",
+		"health-max-block-age": "10s",
+	}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("flatten() = %v, want %v", values, want)
+	}
+}
@@ -1,12 +1,21 @@
 package flags
 
 import (
-	"fmt"
+	"time"
 
+	"github.com/base-org/leader-election/leader/config"
+	"github.com/base-org/leader-election/leader/rpc"
+	"github.com/hashicorp/raft"
 	"github.com/urfave/cli"
 )
 
 var (
+	ConfigFile = &cli.StringFlag{
+		Name:   "config",
+		Usage:  "Path to a TOML config file, flags and env vars override its values",
+		EnvVar: "CONFIG",
+	}
+
 	ServerAddr = &cli.StringFlag{
 		Name:   "server-addr",
 		Usage:  "The address to bind to",
@@ -57,6 +66,291 @@ var (
 		EnvVar: "OP_GETH_ADDR",
 	}
 
+	RPCTimeout = &cli.DurationFlag{
+		Name:   "rpc-timeout",
+		Usage:  "The default timeout of calls to op-node, op-batcher and op-geth",
+		EnvVar: "RPC_TIMEOUT",
+		Value:  rpc.DefaultTimeout,
+	}
+
+	RPCMethodTimeouts = &cli.StringSliceFlag{
+		Name:   "rpc-method-timeout",
+		Usage:  "Per-method timeout overriding --rpc-timeout, as method=duration (e.g. admin_startSequencer=5s)",
+		EnvVar: "RPC_METHOD_TIMEOUTS",
+	}
+
+	CatchUpTimeout = &cli.DurationFlag{
+		Name:   "catch-up-timeout",
+		Usage:  "How long a new leader waits for op-geth to catch up to the committed unsafe head before transferring leadership",
+		EnvVar: "CATCH_UP_TIMEOUT",
+		Value:  30 * time.Second,
+	}
+
+	ShutdownTimeout = &cli.DurationFlag{
+		Name:   "shutdown-timeout",
+		Usage:  "How long a graceful shutdown may take to stop the sequencer and hand leadership over",
+		EnvVar: "SHUTDOWN_TIMEOUT",
+		Value:  30 * time.Second,
+	}
+
+	// ============================
+	// Raft related flags
+	// ============================
+	RaftHeartbeatTimeout = &cli.DurationFlag{
+		Name:   "raft-heartbeat-timeout",
+		Usage:  "How long a follower goes without contact from the leader before starting an election",
+		EnvVar: "RAFT_HEARTBEAT_TIMEOUT",
+		Value:  raft.DefaultConfig().HeartbeatTimeout,
+	}
+
+	RaftElectionTimeout = &cli.DurationFlag{
+		Name:   "raft-election-timeout",
+		Usage:  "How long a candidate goes without being elected before starting a new election",
+		EnvVar: "RAFT_ELECTION_TIMEOUT",
+		Value:  raft.DefaultConfig().ElectionTimeout,
+	}
+
+	RaftCommitTimeout = &cli.DurationFlag{
+		Name:   "raft-commit-timeout",
+		Usage:  "How long the leader goes without appending entries before sending a heartbeat",
+		EnvVar: "RAFT_COMMIT_TIMEOUT",
+		Value:  raft.DefaultConfig().CommitTimeout,
+	}
+
+	RaftSnapshotInterval = &cli.DurationFlag{
+		Name:   "raft-snapshot-interval",
+		Usage:  "How often raft checks whether it should take a snapshot",
+		EnvVar: "RAFT_SNAPSHOT_INTERVAL",
+		Value:  raft.DefaultConfig().SnapshotInterval,
+	}
+
+	RaftSnapshotThreshold = &cli.Uint64Flag{
+		Name:   "raft-snapshot-threshold",
+		Usage:  "How many logs are appended since the last snapshot before taking a new one",
+		EnvVar: "RAFT_SNAPSHOT_THRESHOLD",
+		Value:  raft.DefaultConfig().SnapshotThreshold,
+	}
+
+	RaftTrailingLogs = &cli.Uint64Flag{
+		Name:   "raft-trailing-logs",
+		Usage:  "How many logs are kept after a snapshot so slow followers can catch up without a snapshot",
+		EnvVar: "RAFT_TRAILING_LOGS",
+		Value:  raft.DefaultConfig().TrailingLogs,
+	}
+
+	RaftMaxAppendEntries = &cli.IntFlag{
+		Name:   "raft-max-append-entries",
+		Usage:  "The maximum number of logs sent in a single append entries request",
+		EnvVar: "RAFT_MAX_APPEND_ENTRIES",
+		Value:  raft.DefaultConfig().MaxAppendEntries,
+	}
+
+	LeaderLeaseTimeout = &cli.DurationFlag{
+		Name:   "leader-lease-timeout",
+		Usage:  "How long the leader keeps sequencing without confirming it still reaches a quorum, also used as the raft leader lease. Leadership is handed over after 3 leases in a row without a confirmation",
+		EnvVar: "LEADER_LEASE_TIMEOUT",
+		Value:  raft.DefaultConfig().LeaderLeaseTimeout,
+	}
+
+	// ============================
+	// Health check related flags
+	// ============================
+	HealthInterval = &cli.DurationFlag{
+		Name:   "health-interval",
+		Usage:  "How often to check the health of op-node, op-batcher and op-geth",
+		EnvVar: "HEALTH_INTERVAL",
+		Value:  2 * time.Second,
+	}
+
+	HealthUnsafeStallTimeout = &cli.DurationFlag{
+		Name:   "health-unsafe-stall-timeout",
+		Usage:  "How long the op-node unsafe head may stop advancing on the sequencing leader before it is unhealthy",
+		EnvVar: "HEALTH_UNSAFE_STALL_TIMEOUT",
+		Value:  10 * time.Second,
+	}
+
+	HealthMaxL1OriginLag = &cli.Uint64Flag{
+		Name:   "health-max-l1-origin-lag",
+		Usage:  "How many blocks the L1 origin of the unsafe head may trail the L1 head before op-node is unhealthy",
+		EnvVar: "HEALTH_MAX_L1_ORIGIN_LAG",
+		Value:  20,
+	}
+
+	HealthMinPeers = &cli.Uint64Flag{
+		Name:   "health-min-peers",
+		Usage:  "The minimum peer count of a healthy op-geth",
+		EnvVar: "HEALTH_MIN_PEERS",
+		Value:  1,
+	}
+
+	HealthMaxBlockAge = &cli.DurationFlag{
+		Name:   "health-max-block-age",
+		Usage:  "How old the latest op-geth block may be on the sequencing leader before op-geth is unhealthy",
+		EnvVar: "HEALTH_MAX_BLOCK_AGE",
+		Value:  12 * time.Second,
+	}
+
+	HealthFailureThreshold = &cli.IntFlag{
+		Name:   "health-failure-threshold",
+		Usage:  "How many consecutive failed health checks make the sequencer unhealthy",
+		EnvVar: "HEALTH_FAILURE_THRESHOLD",
+		Value:  3,
+	}
+
+	HealthSuccessThreshold = &cli.IntFlag{
+		Name:   "health-success-threshold",
+		Usage:  "How many consecutive passed health checks make the sequencer healthy again",
+		EnvVar: "HEALTH_SUCCESS_THRESHOLD",
+		Value:  2,
+	}
+
+	HealthGracePeriod = &cli.DurationFlag{
+		Name:   "health-grace-period",
+		Usage:  "How long a newly elected leader is not judged on its health",
+		EnvVar: "HEALTH_GRACE_PERIOD",
+		Value:  30 * time.Second,
+	}
+
+	HealthMinTransferInterval = &cli.DurationFlag{
+		Name:   "health-min-transfer-interval",
+		Usage:  "The minimum time between two leadership transfers caused by health checks",
+		EnvVar: "HEALTH_MIN_TRANSFER_INTERVAL",
+		Value:  time.Minute,
+	}
+
+	HealthMinVoters = &cli.IntFlag{
+		Name:   "health-min-voters",
+		Usage:  "The minimum number of voters kept when demoting unhealthy nodes to non-voters, no voter is demoted in a cluster of this many voters or fewer",
+		EnvVar: "HEALTH_MIN_VOTERS",
+		Value:  2,
+	}
+
+	// ============================
+	// Audit log related flags
+	// ============================
+	AuditMaxSize = &cli.IntFlag{
+		Name:   "audit-max-size-mb",
+		Usage:  "The size in megabytes over which the audit log is rotated",
+		EnvVar: "AUDIT_MAX_SIZE_MB",
+		Value:  10,
+	}
+
+	AuditMaxBackups = &cli.IntFlag{
+		Name:   "audit-max-backups",
+		Usage:  "The number of rotated audit log files to retain",
+		EnvVar: "AUDIT_MAX_BACKUPS",
+		Value:  5,
+	}
+
+	// ============================
+	// Metrics related flags
+	// ============================
+	MetricsEnabled = &cli.BoolFlag{
+		Name:   "metrics-enabled",
+		Usage:  "Serve Prometheus metrics",
+		EnvVar: "METRICS_ENABLED",
+	}
+
+	MetricsAddr = &cli.StringFlag{
+		Name:   "metrics-addr",
+		Usage:  "The address to serve Prometheus metrics on",
+		EnvVar: "METRICS_ADDR",
+		Value:  "0.0.0.0:7300",
+	}
+
+	// ============================
+	// Status related flags
+	// ============================
+	StatusEnabled = &cli.BoolFlag{
+		Name:   "status-enabled",
+		Usage:  "Serve the HTTP status API and the /leader and /ready probes",
+		EnvVar: "STATUS_ENABLED",
+	}
+
+	StatusAddr = &cli.StringFlag{
+		Name:   "status-addr",
+		Usage:  "The address to serve the HTTP status API on",
+		EnvVar: "STATUS_ADDR",
+		Value:  "0.0.0.0:7400",
+	}
+
+	// ============================
+	// Tracing related flags
+	// ============================
+	TracingExporter = &cli.StringFlag{
+		Name:   "tracing-exporter",
+		Usage:  "Where to export OpenTelemetry traces: none, stdout or otlp",
+		EnvVar: "TRACING_EXPORTER",
+		Value:  config.TracingExporterNone,
+	}
+
+	TracingEndpoint = &cli.StringFlag{
+		Name:   "tracing-endpoint",
+		Usage:  "The OTLP/HTTP collector URL traces are exported to with --tracing-exporter=otlp",
+		EnvVar: "TRACING_ENDPOINT",
+		Value:  "http://localhost:4318",
+	}
+
+	TracingSampleRatio = &cli.Float64Flag{
+		Name:   "tracing-sample-ratio",
+		Usage:  "The fraction of traces to sample",
+		EnvVar: "TRACING_SAMPLE_RATIO",
+		Value:  1,
+	}
+
+	// ============================
+	// Logging related flags
+	// ============================
+	LogLevel = &cli.StringFlag{
+		Name:   "log-level",
+		Usage:  "The minimum level to log: trace, debug, info, warn or error",
+		EnvVar: "LOG_LEVEL",
+		Value:  "info",
+	}
+
+	LogFormat = &cli.StringFlag{
+		Name:   "log-format",
+		Usage:  "The log format: text or json",
+		EnvVar: "LOG_FORMAT",
+		Value:  config.LogFormatText,
+	}
+
+	// ============================
+	// Admin command flags
+	// ============================
+	AdminAddr = &cli.StringFlag{
+		Name:   "addr",
+		Usage:  "The gRPC address of the elector to query",
+		EnvVar: "ELECTOR_ADDR",
+		Value:  "127.0.0.1:50051",
+	}
+
+	JSONOutput = &cli.BoolFlag{
+		Name:  "json",
+		Usage: "Print the result as JSON",
+	}
+
+	TransferTo = &cli.StringFlag{
+		Name:  "to",
+		Usage: "The ID of the server to hand leadership to, the healthiest, most caught up peer is picked if empty",
+	}
+
+	Resume = &cli.BoolFlag{
+		Name:  "resume",
+		Usage: "Resume sequencing instead of pausing it",
+	}
+
+	AuditLimit = &cli.IntFlag{
+		Name:  "limit",
+		Usage: "The number of latest audit log entries to print",
+		Value: 20,
+	}
+
+	AuditFollow = &cli.BoolFlag{
+		Name:  "follow",
+		Usage: "Keep printing new audit log entries until interrupted",
+	}
+
 	// ============================
 	// Test related flags
 	// ============================
@@ -73,6 +367,12 @@ var (
 	}
 )
 
+// AdminFlags are the flags shared by the commands talking to a running elector.
+var AdminFlags = []cli.Flag{
+	AdminAddr,
+	JSONOutput,
+}
+
 var requiredFlags = []cli.Flag{
 	ServerAddr,
 	ServerID,
@@ -80,11 +380,45 @@ var requiredFlags = []cli.Flag{
 }
 
 var optionalFlags = []cli.Flag{
+	ConfigFile,
 	SnapshotLimit,
 	Bootstrap,
 	OpNodeAddr,
 	OpBatcherAddr,
 	OpGethAddr,
+	RPCTimeout,
+	RPCMethodTimeouts,
+	CatchUpTimeout,
+	LeaderLeaseTimeout,
+	ShutdownTimeout,
+	RaftHeartbeatTimeout,
+	RaftElectionTimeout,
+	RaftCommitTimeout,
+	RaftSnapshotInterval,
+	RaftSnapshotThreshold,
+	RaftTrailingLogs,
+	RaftMaxAppendEntries,
+	HealthInterval,
+	HealthUnsafeStallTimeout,
+	HealthMaxL1OriginLag,
+	HealthMinPeers,
+	HealthMaxBlockAge,
+	HealthFailureThreshold,
+	HealthSuccessThreshold,
+	HealthGracePeriod,
+	HealthMinTransferInterval,
+	HealthMinVoters,
+	AuditMaxSize,
+	AuditMaxBackups,
+	MetricsEnabled,
+	MetricsAddr,
+	StatusEnabled,
+	StatusAddr,
+	TracingExporter,
+	TracingEndpoint,
+	TracingSampleRatio,
+	LogLevel,
+	LogFormat,
 }
 
 var testFlags = []cli.Flag{
@@ -99,12 +433,3 @@ func init() {
 	Flags = append(requiredFlags, optionalFlags...)
 	Flags = append(Flags, testFlags...)
 }
-
-func CheckRequired(ctx *cli.Context) error {
-	for _, f := range requiredFlags {
-		if !ctx.IsSet(f.GetName()) {
-			return cli.NewExitError(fmt.Sprintf("required flag %s not set", f.GetName()), 1)
-		}
-	}
-	return nil
-}
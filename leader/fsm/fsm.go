@@ -0,0 +1,242 @@
+package fsm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/base-org/leader-election/leader/rpc"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+)
+
+// CommandType identifies the kind of a command replicated through the raft log.
+type CommandType string
+
+const (
+	// SetUnsafeHeadCommand records a new unsafe head produced by the active sequencer.
+	SetUnsafeHeadCommand CommandType = "setUnsafeHead"
+	// MarkDemotedCommand records that a voter was demoted because it was unhealthy.
+	MarkDemotedCommand CommandType = "markDemoted"
+	// ClearDemotedCommand records that a demoted server was promoted back or removed.
+	ClearDemotedCommand CommandType = "clearDemoted"
+	// SetSequencingPausedCommand pauses or resumes sequencing on every leader.
+	SetSequencingPausedCommand CommandType = "setSequencingPaused"
+)
+
+var (
+	// ErrStaleHead is returned by Apply when the proposed head does not advance the committed head.
+	ErrStaleHead = errors.New("unsafe head does not advance the committed head")
+	// ErrStaleFencingToken is returned by Apply when the head was proposed by an older leader
+	// than the one that committed the current head.
+	ErrStaleFencingToken = errors.New("unsafe head proposed with a stale fencing token")
+)
+
+// Head is an unsafe L2 block produced by the sequencer.
+type Head struct {
+	Hash   common.Hash `json:"hash"`
+	Number uint64      `json:"number"`
+}
+
+// IsZero returns true if no head has been committed yet. Every block, genesis included,
+// has a non-zero hash.
+func (h Head) IsZero() bool {
+	return h.Hash == (common.Hash{})
+}
+
+func (h Head) String() string {
+	return fmt.Sprintf("%s:%d", h.Hash.String(), h.Number)
+}
+
+// Command is the envelope of every entry written to the raft log.
+type Command struct {
+	Type     CommandType       `json:"type"`
+	Head     *Head             `json:"head,omitempty"`
+	Token    *rpc.FencingToken `json:"token,omitempty"`
+	ServerID string            `json:"serverId,omitempty"`
+	Paused   bool              `json:"paused,omitempty"`
+}
+
+// Encode serializes the command for raft.Apply.
+func (c Command) Encode() ([]byte, error) {
+	return json.Marshal(c)
+}
+
+// NewSetUnsafeHead returns the encoded command committing the given head on behalf of the
+// leader holding the fencing token.
+func NewSetUnsafeHead(head Head, token rpc.FencingToken) ([]byte, error) {
+	return Command{Type: SetUnsafeHeadCommand, Head: &head, Token: &token}.Encode()
+}
+
+// NewMarkDemoted returns the encoded command recording that a server was demoted.
+func NewMarkDemoted(id string) ([]byte, error) {
+	return Command{Type: MarkDemotedCommand, ServerID: id}.Encode()
+}
+
+// NewClearDemoted returns the encoded command recording that a server is no longer demoted.
+func NewClearDemoted(id string) ([]byte, error) {
+	return Command{Type: ClearDemotedCommand, ServerID: id}.Encode()
+}
+
+// NewSetSequencingPaused returns the encoded command pausing or resuming sequencing.
+func NewSetSequencingPaused(paused bool) ([]byte, error) {
+	return Command{Type: SetSequencingPausedCommand, Paused: paused}.Encode()
+}
+
+// state is the replicated state of the cluster, it is also the snapshot format.
+type state struct {
+	UnsafeHead Head `json:"unsafeHead"`
+	// Token is the highest fencing token a head was committed with.
+	Token rpc.FencingToken `json:"token"`
+	// Demoted holds the IDs of the servers demoted to non-voters for being unhealthy.
+	Demoted map[string]bool `json:"demoted,omitempty"`
+	// SequencingPaused is set while operators paused sequencing, leaders do not start the
+	// sequencer until it is resumed.
+	SequencingPaused bool `json:"sequencingPaused,omitempty"`
+}
+
+// UnsafeHeadFSM is a raft.FSM that tracks the last unsafe head committed by the cluster, the
+// fencing token of the leader that committed it, and the servers demoted for being unhealthy.
+type UnsafeHeadFSM struct {
+	mu    sync.RWMutex
+	state state
+}
+
+var _ raft.FSM = (*UnsafeHeadFSM)(nil)
+
+func New() *UnsafeHeadFSM {
+	return &UnsafeHeadFSM{}
+}
+
+// Head returns the last committed unsafe head.
+func (f *UnsafeHeadFSM) Head() Head {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.state.UnsafeHead
+}
+
+// FencingToken returns the highest fencing token a head was committed with.
+func (f *UnsafeHeadFSM) FencingToken() rpc.FencingToken {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.state.Token
+}
+
+// SequencingPaused returns true if operators paused sequencing.
+func (f *UnsafeHeadFSM) SequencingPaused() bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.state.SequencingPaused
+}
+
+// Demoted returns the IDs of the servers demoted for being unhealthy.
+func (f *UnsafeHeadFSM) Demoted() []string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	ids := make([]string, 0, len(f.state.Demoted))
+	for id := range f.state.Demoted {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// IsDemoted returns true if the server was demoted for being unhealthy.
+func (f *UnsafeHeadFSM) IsDemoted(id string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.state.Demoted[id]
+}
+
+// Apply implements raft.FSM.
+func (f *UnsafeHeadFSM) Apply(l *raft.Log) interface{} {
+	var cmd Command
+	if err := json.Unmarshal(l.Data, &cmd); err != nil {
+		return errors.Wrap(err, "failed to unmarshal command")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch cmd.Type {
+	case SetUnsafeHeadCommand:
+		if cmd.Head == nil {
+			return errors.New("missing head in command")
+		}
+		if cmd.Token != nil && cmd.Token.Less(f.state.Token) {
+			return ErrStaleFencingToken
+		}
+		current := f.state.UnsafeHead
+		if !current.IsZero() && cmd.Head.Number <= current.Number {
+			return ErrStaleHead
+		}
+		f.state.UnsafeHead = *cmd.Head
+		if cmd.Token != nil {
+			f.state.Token = *cmd.Token
+		}
+		return nil
+	case MarkDemotedCommand:
+		if f.state.Demoted == nil {
+			f.state.Demoted = make(map[string]bool)
+		}
+		f.state.Demoted[cmd.ServerID] = true
+		return nil
+	case ClearDemotedCommand:
+		delete(f.state.Demoted, cmd.ServerID)
+		return nil
+	case SetSequencingPausedCommand:
+		f.state.SequencingPaused = cmd.Paused
+		return nil
+	default:
+		return fmt.Errorf("unknown command type %q", cmd.Type)
+	}
+}
+
+// Snapshot implements raft.FSM.
+func (f *UnsafeHeadFSM) Snapshot() (raft.FSMSnapshot, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	data, err := json.Marshal(f.state)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal state")
+	}
+	return &snapshot{data: data}, nil
+}
+
+// Restore implements raft.FSM.
+func (f *UnsafeHeadFSM) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+
+	var s state
+	if err := json.NewDecoder(rc).Decode(&s); err != nil {
+		return errors.Wrap(err, "failed to decode snapshot")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.state = s
+	return nil
+}
+
+type snapshot struct {
+	data []byte
+}
+
+var _ raft.FSMSnapshot = (*snapshot)(nil)
+
+// Persist implements raft.FSMSnapshot.
+func (s *snapshot) Persist(sink raft.SnapshotSink) error {
+	if _, err := sink.Write(s.data); err != nil {
+		sink.Cancel()
+		return errors.Wrap(err, "failed to write snapshot")
+	}
+	return sink.Close()
+}
+
+// Release implements raft.FSMSnapshot.
+func (s *snapshot) Release() {}
@@ -0,0 +1,189 @@
+package fsm
+
+import (
+	"bytes"
+	"io"
+	"math/big"
+	"testing"
+
+	"github.com/base-org/leader-election/leader/rpc"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/hashicorp/raft"
+)
+
+// head returns a head with a non-zero hash derived from its number.
+func head(n uint64) Head {
+	return Head{Hash: common.BigToHash(new(big.Int).SetUint64(n + 1)), Number: n}
+}
+
+// cmd returns an encoded command, it panics if encoding failed.
+func cmd(data []byte, err error) []byte {
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+func apply(f *UnsafeHeadFSM, data []byte) error {
+	resp := f.Apply(&raft.Log{Data: data})
+	if resp == nil {
+		return nil
+	}
+	return resp.(error)
+}
+
+func TestApplySetUnsafeHead(t *testing.T) {
+	committed := head(10)
+	token := rpc.FencingToken{Term: 2, Index: 5}
+
+	tests := []struct {
+		name  string
+		head  Head
+		token rpc.FencingToken
+		want  error
+	}{
+		{name: "advances head", head: head(11), token: token},
+		{name: "newer leader", head: head(11), token: rpc.FencingToken{Term: 3, Index: 1}},
+		{name: "same head", head: committed, token: token, want: ErrStaleHead},
+		{name: "older head", head: head(9), token: token, want: ErrStaleHead},
+		{name: "older term", head: head(11), token: rpc.FencingToken{Term: 1, Index: 20}, want: ErrStaleFencingToken},
+		{name: "older index", head: head(11), token: rpc.FencingToken{Term: 2, Index: 4}, want: ErrStaleFencingToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := New()
+			if err := apply(f, cmd(NewSetUnsafeHead(committed, token))); err != nil {
+				t.Fatalf("failed to commit first head: %v", err)
+			}
+
+			err := apply(f, cmd(NewSetUnsafeHead(tt.head, tt.token)))
+			if err != tt.want {
+				t.Fatalf("Apply() = %v, want %v", err, tt.want)
+			}
+			wantHead, wantToken := tt.head, tt.token
+			if tt.want != nil {
+				wantHead, wantToken = committed, token
+			}
+			if got := f.Head(); got != wantHead {
+				t.Errorf("Head() = %v, want %v", got, wantHead)
+			}
+			if got := f.FencingToken(); got != wantToken {
+				t.Errorf("FencingToken() = %v, want %v", got, wantToken)
+			}
+		})
+	}
+}
+
+func TestApplyFirstHead(t *testing.T) {
+	f := New()
+	if !f.Head().IsZero() {
+		t.Fatalf("Head() = %v, want zero", f.Head())
+	}
+	if err := apply(f, cmd(NewSetUnsafeHead(head(0), rpc.FencingToken{Term: 1, Index: 1}))); err != nil {
+		t.Fatalf("Apply() = %v, want nil", err)
+	}
+	if got := f.Head(); got != head(0) {
+		t.Errorf("Head() = %v, want %v", got, head(0))
+	}
+}
+
+func TestApplyInvalidCommand(t *testing.T) {
+	f := New()
+	for _, data := range []string{`not json`, `{"type":"unknown"}`, `{"type":"setUnsafeHead"}`} {
+		if resp := f.Apply(&raft.Log{Data: []byte(data)}); resp == nil {
+			t.Errorf("Apply(%s) = nil, want an error", data)
+		}
+	}
+}
+
+func TestApplyDemotedAndPaused(t *testing.T) {
+	f := New()
+	for _, id := range []string{"b", "a"} {
+		if err := apply(f, cmd(NewMarkDemoted(id))); err != nil {
+			t.Fatalf("failed to mark %s demoted: %v", id, err)
+		}
+	}
+	if err := apply(f, cmd(NewClearDemoted("b"))); err != nil {
+		t.Fatalf("failed to clear b: %v", err)
+	}
+	if got := f.Demoted(); len(got) != 1 || got[0] != "a" {
+		t.Errorf("Demoted() = %v, want [a]", got)
+	}
+	if !f.IsDemoted("a") || f.IsDemoted("b") {
+		t.Errorf("IsDemoted(a), IsDemoted(b) = %t, %t, want true, false", f.IsDemoted("a"), f.IsDemoted("b"))
+	}
+
+	if err := apply(f, cmd(NewSetSequencingPaused(true))); err != nil {
+		t.Fatalf("failed to pause: %v", err)
+	}
+	if !f.SequencingPaused() {
+		t.Errorf("SequencingPaused() = false, want true")
+	}
+}
+
+// sink is a raft.SnapshotSink writing to memory.
+type sink struct {
+	bytes.Buffer
+}
+
+func (s *sink) ID() string    { return "test" }
+func (s *sink) Close() error  { return nil }
+func (s *sink) Cancel() error { return nil }
+
+func TestSnapshotRestore(t *testing.T) {
+	f := New()
+	token := rpc.FencingToken{Term: 4, Index: 12}
+	if err := apply(f, cmd(NewSetUnsafeHead(head(7), token))); err != nil {
+		t.Fatalf("failed to commit head: %v", err)
+	}
+	if err := apply(f, cmd(NewMarkDemoted("c"))); err != nil {
+		t.Fatalf("failed to mark demoted: %v", err)
+	}
+	if err := apply(f, cmd(NewSetSequencingPaused(true))); err != nil {
+		t.Fatalf("failed to pause: %v", err)
+	}
+
+	snap, err := f.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot() = %v", err)
+	}
+	var s sink
+	if err := snap.Persist(&s); err != nil {
+		t.Fatalf("Persist() = %v", err)
+	}
+	snap.Release()
+
+	// Changes after the snapshot must not leak into it.
+	if err := apply(f, cmd(NewSetUnsafeHead(head(8), token))); err != nil {
+		t.Fatalf("failed to commit head: %v", err)
+	}
+
+	restored := New()
+	if err := restored.Restore(io.NopCloser(&s)); err != nil {
+		t.Fatalf("Restore() = %v", err)
+	}
+	if got := restored.Head(); got != head(7) {
+		t.Errorf("Head() = %v, want %v", got, head(7))
+	}
+	if got := restored.FencingToken(); got != token {
+		t.Errorf("FencingToken() = %v, want %v", got, token)
+	}
+	if !restored.IsDemoted("c") {
+		t.Errorf("IsDemoted(c) = false, want true")
+	}
+	if !restored.SequencingPaused() {
+		t.Errorf("SequencingPaused() = false, want true")
+	}
+
+	// The restored state still rejects stale heads.
+	if err := apply(restored, cmd(NewSetUnsafeHead(head(7), token))); err != ErrStaleHead {
+		t.Errorf("Apply() = %v, want %v", err, ErrStaleHead)
+	}
+}
+
+func TestRestoreInvalidSnapshot(t *testing.T) {
+	f := New()
+	if err := f.Restore(io.NopCloser(bytes.NewBufferString("not json"))); err == nil {
+		t.Fatalf("Restore() = nil, want an error")
+	}
+}
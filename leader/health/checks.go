@@ -0,0 +1,185 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/base-org/leader-election/leader/config"
+	"github.com/base-org/leader-election/leader/rpc"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/hashicorp/go-hclog"
+)
+
+const (
+	// checkTimeout bounds a single health check call.
+	checkTimeout = 2 * time.Second
+
+	healthzPath            = "/healthz"
+	syncStatusMethod       = "optimism_syncStatus"
+	peerCountMethod        = "net_peerCount"
+	getBlockByNumberMethod = "eth_getBlockByNumber"
+)
+
+// Checker checks the health of a single component.
+type Checker interface {
+	// Name identifies the checked component.
+	Name() string
+	// Check returns an error describing why the component is unhealthy, or nil if healthy.
+	Check(ctx context.Context) error
+}
+
+// checkHealthz returns an error unless the server answers its healthz endpoint with 200.
+func checkHealthz(ctx context.Context, client *rpc.Client) error {
+	status, err := client.Ping(ctx, healthzPath)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("healthz returned status %d", status)
+	}
+	return nil
+}
+
+// NodeChecker checks that op-node is serving, that its unsafe head keeps advancing while the
+// local sequencer is supposed to produce blocks and that the L1 origin of its unsafe head is
+// close to the L1 head.
+type NodeChecker struct {
+	client     *rpc.Client
+	cfg        config.HealthConfig
+	sequencing func() bool
+
+	lastUnsafe  uint64
+	lastAdvance time.Time
+	// wasSequencing is whether the local sequencer was supposed to run at the last check.
+	wasSequencing bool
+}
+
+var _ Checker = (*NodeChecker)(nil)
+
+// NewNodeChecker returns a NodeChecker, sequencing reports whether the local sequencer is
+// supposed to produce blocks. A stalled chain is not a fault of a node that does not
+// sequence it, e.g. while sequencing is paused.
+func NewNodeChecker(serverAddr string, cfg config.HealthConfig, sequencing func() bool, log hclog.Logger) *NodeChecker {
+	return &NodeChecker{
+		client:     rpc.NewClient(serverAddr, rpc.Timeouts{Default: checkTimeout}, log),
+		cfg:        cfg,
+		sequencing: sequencing,
+	}
+}
+
+// Name implements Checker.
+func (c *NodeChecker) Name() string {
+	return ComponentNode
+}
+
+// Check implements Checker.
+func (c *NodeChecker) Check(ctx context.Context) error {
+	if err := checkHealthz(ctx, c.client); err != nil {
+		return err
+	}
+
+	var status rpc.SyncStatus
+	if err := c.client.Call(ctx, syncStatusMethod, nil, &status); err != nil {
+		return err
+	}
+
+	// The stall timeout starts when the local sequencer is supposed to start running.
+	now := time.Now()
+	sequencing := c.sequencing()
+	started := sequencing && !c.wasSequencing
+	c.wasSequencing = sequencing
+	if !sequencing || started || c.lastAdvance.IsZero() || status.UnsafeL2.Number > c.lastUnsafe {
+		c.lastUnsafe = status.UnsafeL2.Number
+		c.lastAdvance = now
+	} else if stalled := now.Sub(c.lastAdvance); stalled > c.cfg.UnsafeStallTimeout {
+		return fmt.Errorf("unsafe head %d has not advanced for %s", c.lastUnsafe, stalled)
+	}
+
+	origin := status.UnsafeL2.L1Origin.Number
+	if status.HeadL1.Number > origin && status.HeadL1.Number-origin > c.cfg.MaxL1OriginLag {
+		return fmt.Errorf("unsafe head L1 origin %d is %d blocks behind L1 head %d", origin, status.HeadL1.Number-origin, status.HeadL1.Number)
+	}
+	return nil
+}
+
+// GethChecker checks that op-geth has enough peers and that its latest block is recent while
+// the local sequencer is supposed to produce blocks.
+type GethChecker struct {
+	client     *rpc.Client
+	cfg        config.HealthConfig
+	sequencing func() bool
+}
+
+var _ Checker = (*GethChecker)(nil)
+
+// NewGethChecker returns a GethChecker, sequencing reports whether the local sequencer is
+// supposed to produce blocks, see NewNodeChecker.
+func NewGethChecker(serverAddr string, cfg config.HealthConfig, sequencing func() bool, log hclog.Logger) *GethChecker {
+	return &GethChecker{
+		client:     rpc.NewClient(serverAddr, rpc.Timeouts{Default: checkTimeout}, log),
+		cfg:        cfg,
+		sequencing: sequencing,
+	}
+}
+
+// Name implements Checker.
+func (c *GethChecker) Name() string {
+	return ComponentGeth
+}
+
+// Check implements Checker.
+func (c *GethChecker) Check(ctx context.Context) error {
+	var peers hexutil.Uint64
+	var block *rpc.Block
+	batch := []rpc.BatchElem{
+		{Method: peerCountMethod, Result: &peers},
+		{Method: getBlockByNumberMethod, Params: []any{"latest", false}, Result: &block},
+	}
+	if err := c.client.BatchCall(ctx, batch); err != nil {
+		return err
+	}
+	for _, elem := range batch {
+		if elem.Error != nil {
+			return fmt.Errorf("%s: %w", elem.Method, elem.Error)
+		}
+	}
+
+	if uint64(peers) < c.cfg.MinPeers {
+		return fmt.Errorf("peer count %d is below minimum %d", peers, c.cfg.MinPeers)
+	}
+	if block == nil {
+		return fmt.Errorf("latest block not found")
+	}
+	if !c.sequencing() {
+		return nil
+	}
+	if age := time.Since(time.Unix(int64(block.Timestamp), 0)); age > c.cfg.MaxBlockAge {
+		return fmt.Errorf("latest block %d is %s old", block.Number, age.Truncate(time.Second))
+	}
+	return nil
+}
+
+// BatcherChecker checks that op-batcher is serving.
+type BatcherChecker struct {
+	client *rpc.Client
+}
+
+var _ Checker = (*BatcherChecker)(nil)
+
+func NewBatcherChecker(serverAddr string, log hclog.Logger) *BatcherChecker {
+	return &BatcherChecker{
+		client: rpc.NewClient(serverAddr, rpc.Timeouts{Default: checkTimeout}, log),
+	}
+}
+
+// Name implements Checker.
+func (c *BatcherChecker) Name() string {
+	return ComponentBatcher
+}
+
+// Check implements Checker.
+func (c *BatcherChecker) Check(ctx context.Context) error {
+	return checkHealthz(ctx, c.client)
+}
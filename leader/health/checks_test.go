@@ -0,0 +1,76 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/base-org/leader-election/leader/config"
+	"github.com/hashicorp/go-hclog"
+)
+
+// stalledNode serves an op-node whose unsafe head never advances.
+func stalledNode(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == healthzPath {
+			return
+		}
+		var req struct {
+			ID uint64 `json:"id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%d,"result":{"unsafe_l2":{"number":5}}}`, req.ID)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestNodeCheckerStall(t *testing.T) {
+	tests := []struct {
+		name       string
+		sequencing bool
+		wantErr    bool
+	}{
+		{name: "leader with a stalled head is unhealthy", sequencing: true, wantErr: true},
+		{name: "follower with a stalled head is healthy", sequencing: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := stalledNode(t)
+			cfg := config.HealthConfig{UnsafeStallTimeout: time.Millisecond}
+			c := NewNodeChecker(srv.URL, cfg, func() bool { return tt.sequencing }, hclog.NewNullLogger())
+
+			if err := c.Check(context.Background()); err != nil {
+				t.Fatalf("first Check() = %v, want nil", err)
+			}
+			time.Sleep(5 * time.Millisecond)
+			if err := c.Check(context.Background()); (err != nil) != tt.wantErr {
+				t.Fatalf("Check() = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNodeCheckerStallStartsWhenSequencing(t *testing.T) {
+	srv := stalledNode(t)
+	sequencing := false
+	cfg := config.HealthConfig{UnsafeStallTimeout: 50 * time.Millisecond}
+	c := NewNodeChecker(srv.URL, cfg, func() bool { return sequencing }, hclog.NewNullLogger())
+
+	if err := c.Check(context.Background()); err != nil {
+		t.Fatalf("Check() = %v, want nil", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// The head stalled while following, a new leader gets the whole timeout to produce blocks.
+	sequencing = true
+	if err := c.Check(context.Background()); err != nil {
+		t.Fatalf("Check() right after taking over = %v, want nil", err)
+	}
+}
@@ -0,0 +1,41 @@
+package health
+
+// Hysteresis damps flapping health results: the reported status only flips after a number
+// of consecutive results disagreeing with it. It starts healthy.
+type Hysteresis struct {
+	failureThreshold int
+	successThreshold int
+
+	healthy bool
+	streak  int
+}
+
+// NewHysteresis returns a Hysteresis reporting unhealthy after failureThreshold consecutive
+// failures, and healthy again after successThreshold consecutive successes. Thresholds
+// below 1 are treated as 1.
+func NewHysteresis(failureThreshold, successThreshold int) *Hysteresis {
+	return &Hysteresis{
+		failureThreshold: max(failureThreshold, 1),
+		successThreshold: max(successThreshold, 1),
+		healthy:          true,
+	}
+}
+
+// Observe records a raw health result and returns the damped status.
+func (h *Hysteresis) Observe(healthy bool) bool {
+	if healthy == h.healthy {
+		h.streak = 0
+		return h.healthy
+	}
+
+	h.streak++
+	threshold := h.failureThreshold
+	if healthy {
+		threshold = h.successThreshold
+	}
+	if h.streak >= threshold {
+		h.healthy = healthy
+		h.streak = 0
+	}
+	return h.healthy
+}
@@ -0,0 +1,59 @@
+package health
+
+import "testing"
+
+func TestHysteresis(t *testing.T) {
+	tests := []struct {
+		name             string
+		failureThreshold int
+		successThreshold int
+		observed         []bool
+		want             []bool
+	}{
+		{
+			name:             "starts healthy",
+			failureThreshold: 3,
+			successThreshold: 2,
+			observed:         []bool{true, true},
+			want:             []bool{true, true},
+		},
+		{
+			name:             "turns unhealthy after consecutive failures",
+			failureThreshold: 3,
+			successThreshold: 2,
+			observed:         []bool{false, false, false, false},
+			want:             []bool{true, true, false, false},
+		},
+		{
+			name:             "a success resets the failure streak",
+			failureThreshold: 3,
+			successThreshold: 2,
+			observed:         []bool{false, false, true, false, false, false},
+			want:             []bool{true, true, true, true, true, false},
+		},
+		{
+			name:             "recovers after consecutive successes",
+			failureThreshold: 1,
+			successThreshold: 3,
+			observed:         []bool{false, true, true, false, true, true, true},
+			want:             []bool{false, false, false, false, false, false, true},
+		},
+		{
+			name:             "thresholds below one flip immediately",
+			failureThreshold: 0,
+			successThreshold: -1,
+			observed:         []bool{false, true, false},
+			want:             []bool{false, true, false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHysteresis(tt.failureThreshold, tt.successThreshold)
+			for i, healthy := range tt.observed {
+				if got := h.Observe(healthy); got != tt.want[i] {
+					t.Fatalf("Observe #%d(%t) = %t, want %t", i, healthy, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
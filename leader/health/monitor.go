@@ -1,102 +1,151 @@
 package health
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/base-org/leader-election/leader/config"
+	"github.com/hashicorp/go-hclog"
 )
 
 type HealthMonitor interface {
-	Subscribe() <-chan bool
+	// Subscribe returns a channel receiving the latest health reports.
+	Subscribe() <-chan HealthReport
+	// Unsubscribe stops delivering reports to a channel returned by Subscribe and closes it.
+	Unsubscribe(ch <-chan HealthReport)
+	// Close stops the monitor and closes every subscription.
+	Close()
 }
 
+// poller runs a health check every interval and publishes its report, until its context is
+// cancelled or it is closed.
+type poller struct {
+	*Broadcaster
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func startPoller(ctx context.Context, interval time.Duration, check func(context.Context) HealthReport) *poller {
+	ctx, cancel := context.WithCancel(ctx)
+	p := &poller{
+		Broadcaster: NewBroadcaster(),
+		cancel:      cancel,
+		done:        make(chan struct{}),
+	}
+
+	go func() {
+		defer close(p.done)
+		defer p.Broadcaster.Close()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			p.Publish(check(ctx))
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return p
+}
+
+// Close stops polling and waits for an in-flight check to return.
+func (p *poller) Close() {
+	p.cancel()
+	<-p.done
+}
+
+// SimpleHealthMonitor periodically runs the health checks of op-node, op-batcher and op-geth
+// and notifies subscribers with a report of each round.
 type SimpleHealthMonitor struct {
-	subscribers   []chan bool
-	nodeClient    *Client
-	batcherClient *Client
+	*poller
+	log      hclog.Logger
+	checkers []Checker
+	reporter *reporter
 }
 
 var _ HealthMonitor = (*SimpleHealthMonitor)(nil)
 
-func NewSimpleHealthMonitor(cfg *config.Config) HealthMonitor {
+// NewSimpleHealthMonitor starts monitoring until ctx is cancelled or the monitor is closed.
+// sequencing reports whether the local sequencer is supposed to produce blocks, the chain
+// is only expected to advance then.
+func NewSimpleHealthMonitor(ctx context.Context, cfg *config.Config, sequencing func() bool, log hclog.Logger) HealthMonitor {
 	m := &SimpleHealthMonitor{
-		subscribers:   make([]chan bool, 0),
-		nodeClient:    NewClient(cfg.NodeAddr),
-		batcherClient: NewClient(cfg.BatcherAddr),
+		log: log,
+		checkers: []Checker{
+			NewNodeChecker(cfg.NodeAddr, cfg.Health, sequencing, log.Named(ComponentNode)),
+			NewBatcherChecker(cfg.BatcherAddr, log.Named(ComponentBatcher)),
+			NewGethChecker(cfg.GethAddr, cfg.Health, sequencing, log.Named(ComponentGeth)),
+		},
+		reporter: newReporter(cfg.Health),
 	}
-
-	go m.notifyHealth()
+	m.poller = startPoller(ctx, cfg.Health.Interval, m.check)
 	return m
 }
 
-// Subscribe implements HealthMonitor.
-func (m *SimpleHealthMonitor) Subscribe() <-chan bool {
-	ch := make(chan bool)
-	m.subscribers = append(m.subscribers, ch)
-	return ch
-}
-
-func (m *SimpleHealthMonitor) notifyHealth() {
-	for {
-		nodeHealthy, err := m.nodeClient.Healthy()
-		if err != nil {
-			fmt.Println("node client error", err)
-		}
-
-		batcherHealthy, err := m.batcherClient.Healthy()
+func (m *SimpleHealthMonitor) check(ctx context.Context) HealthReport {
+	results := make([]ComponentStatus, 0, len(m.checkers))
+	for _, c := range m.checkers {
+		start := time.Now()
+		err := c.Check(ctx)
+		status := ComponentStatus{Name: c.Name(), Healthy: err == nil, Latency: time.Since(start)}
 		if err != nil {
-			fmt.Println("batcher client error", err)
+			m.log.Warn("health check failed", "component", c.Name(), "err", err)
+			status.Error = err.Error()
 		}
-
-		healthy := nodeHealthy && batcherHealthy
-		for _, ch := range m.subscribers {
-			ch <- healthy
-		}
-
-		time.Sleep(2 * time.Second)
+		results = append(results, status)
 	}
+	return m.reporter.report(results)
 }
 
+// MockHealthMonitor mocks the health of the components from a file. If the file exists,
+// the components it lists (one name per line) are unhealthy, or op-node if it is empty.
 type MockHealthMonitor struct {
-	// Not healthy if file exists, this is used to mock node's health status.
-	healthFile  string
-	subscribers []chan bool
+	*poller
+	log        hclog.Logger
+	healthFile string
+	reporter   *reporter
 }
 
 var _ HealthMonitor = (*MockHealthMonitor)(nil)
 
-func NewMockHealthMonitor(healthFile string) HealthMonitor {
+// NewMockHealthMonitor starts monitoring until ctx is cancelled or the monitor is closed.
+func NewMockHealthMonitor(ctx context.Context, healthFile string, cfg config.HealthConfig, log hclog.Logger) HealthMonitor {
 	m := &MockHealthMonitor{
-		healthFile:  healthFile,
-		subscribers: make([]chan bool, 0),
+		log:        log,
+		healthFile: healthFile,
+		reporter:   newReporter(cfg),
 	}
-
-	go m.notifyHealth()
+	m.poller = startPoller(ctx, cfg.Interval, m.check)
 	return m
 }
 
-// Subscribe implements HealthMonitor.
-func (m *MockHealthMonitor) Subscribe() <-chan bool {
-	ch := make(chan bool)
-	m.subscribers = append(m.subscribers, ch)
-	return ch
-}
-
-func (m *MockHealthMonitor) notifyHealth() {
-	for {
-		healthy := true
-		_, err := os.Stat(m.healthFile)
-		fmt.Println(m.healthFile, err)
-		if err == nil {
-			healthy = false
+func (m *MockHealthMonitor) check(ctx context.Context) HealthReport {
+	unhealthy := make(map[string]bool)
+	data, err := os.ReadFile(m.healthFile)
+	m.log.Trace("read mock health file", "path", m.healthFile, "err", err)
+	if err == nil {
+		for _, name := range strings.Fields(string(data)) {
+			unhealthy[name] = true
 		}
-
-		for _, ch := range m.subscribers {
-			ch <- healthy
+		if len(unhealthy) == 0 {
+			unhealthy[ComponentNode] = true
 		}
+	}
 
-		time.Sleep(2 * time.Second)
+	results := make([]ComponentStatus, 0, 3)
+	for _, name := range []string{ComponentNode, ComponentBatcher, ComponentGeth} {
+		status := ComponentStatus{Name: name, Healthy: !unhealthy[name]}
+		if unhealthy[name] {
+			status.Error = fmt.Sprintf("marked unhealthy by %s", m.healthFile)
+		}
+		results = append(results, status)
 	}
+	return m.reporter.report(results)
 }
@@ -0,0 +1,79 @@
+package health
+
+import "sync"
+
+// Broadcaster fans HealthReports out to subscribers. Delivery is latest-value-wins: each
+// subscriber buffers a single report, which is replaced by newer ones until it is received,
+// so publishing never blocks on a slow subscriber. It is safe for concurrent use.
+type Broadcaster struct {
+	mu     sync.Mutex
+	subs   map[<-chan HealthReport]chan HealthReport
+	closed bool
+}
+
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{
+		subs: make(map[<-chan HealthReport]chan HealthReport),
+	}
+}
+
+// Subscribe returns a channel receiving the reports published from now on. The channel is
+// closed by Unsubscribe or Close.
+func (b *Broadcaster) Subscribe() <-chan HealthReport {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan HealthReport, 1)
+	if b.closed {
+		close(ch)
+		return ch
+	}
+	b.subs[ch] = ch
+	return ch
+}
+
+// Unsubscribe stops delivering reports to ch and closes it.
+func (b *Broadcaster) Unsubscribe(ch <-chan HealthReport) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if sub, ok := b.subs[ch]; ok {
+		delete(b.subs, ch)
+		close(sub)
+	}
+}
+
+// Publish delivers the report to every subscriber without blocking.
+func (b *Broadcaster) Publish(report HealthReport) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, sub := range b.subs {
+		select {
+		case sub <- report:
+			continue
+		default:
+		}
+		// Drop the stale report the subscriber has not received yet.
+		select {
+		case <-sub:
+		default:
+		}
+		sub <- report
+	}
+}
+
+// Close closes every subscription, later subscriptions are closed immediately.
+func (b *Broadcaster) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for ch, sub := range b.subs {
+		delete(b.subs, ch)
+		close(sub)
+	}
+}
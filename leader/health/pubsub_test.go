@@ -0,0 +1,90 @@
+package health
+
+import (
+	"testing"
+	"time"
+)
+
+func report(healthy bool) HealthReport {
+	return HealthReport{Healthy: healthy, Timestamp: time.Now()}
+}
+
+func TestBroadcasterLatestValueWins(t *testing.T) {
+	b := NewBroadcaster()
+	ch := b.Subscribe()
+
+	// A subscriber that does not receive never blocks publishing.
+	first, last := report(false), report(true)
+	b.Publish(first)
+	b.Publish(report(false))
+	b.Publish(last)
+
+	select {
+	case got := <-ch:
+		if !got.Timestamp.Equal(last.Timestamp) || got.Healthy != last.Healthy {
+			t.Fatalf("received %+v, want the latest report %+v", got, last)
+		}
+	default:
+		t.Fatalf("no report received")
+	}
+	select {
+	case got := <-ch:
+		t.Fatalf("received stale report %+v", got)
+	default:
+	}
+}
+
+func TestBroadcasterFanOut(t *testing.T) {
+	b := NewBroadcaster()
+	subs := []<-chan HealthReport{b.Subscribe(), b.Subscribe()}
+
+	b.Publish(report(true))
+	for i, ch := range subs {
+		select {
+		case got := <-ch:
+			if !got.Healthy {
+				t.Errorf("subscriber %d received %+v, want healthy", i, got)
+			}
+		default:
+			t.Errorf("subscriber %d received no report", i)
+		}
+	}
+}
+
+func TestBroadcasterUnsubscribe(t *testing.T) {
+	b := NewBroadcaster()
+	ch := b.Subscribe()
+	other := b.Subscribe()
+
+	b.Unsubscribe(ch)
+	if _, ok := <-ch; ok {
+		t.Fatalf("channel still open after Unsubscribe")
+	}
+	// Unsubscribing twice is a no-op.
+	b.Unsubscribe(ch)
+
+	b.Publish(report(true))
+	if _, ok := <-other; !ok {
+		t.Fatalf("other subscriber closed by Unsubscribe")
+	}
+}
+
+func TestBroadcasterClose(t *testing.T) {
+	b := NewBroadcaster()
+	ch := b.Subscribe()
+
+	b.Close()
+	if _, ok := <-ch; ok {
+		t.Fatalf("channel still open after Close")
+	}
+
+	// Publishing and closing again after Close must not panic.
+	b.Publish(report(true))
+	b.Close()
+
+	late := b.Subscribe()
+	if _, ok := <-late; ok {
+		t.Fatalf("subscription after Close is open")
+	}
+	b.Unsubscribe(late)
+}
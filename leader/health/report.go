@@ -0,0 +1,112 @@
+package health
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/base-org/leader-election/leader/config"
+)
+
+// Names of the components checked by the health monitors.
+const (
+	ComponentNode    = "op-node"
+	ComponentBatcher = "op-batcher"
+	ComponentGeth    = "op-geth"
+)
+
+// ComponentStatus is the health of a single component.
+type ComponentStatus struct {
+	Name string `json:"name"`
+	// Healthy is the damped status of the component, see Hysteresis.
+	Healthy bool `json:"healthy"`
+	// Latency is how long the last check took.
+	Latency time.Duration `json:"latency"`
+	// Error is why the last check failed, empty if it passed.
+	Error string `json:"error,omitempty"`
+}
+
+// HealthReport is published by a HealthMonitor after each round of checks.
+type HealthReport struct {
+	// Healthy is true if every component is healthy.
+	Healthy    bool              `json:"healthy"`
+	Components []ComponentStatus `json:"components"`
+	Timestamp  time.Time         `json:"timestamp"`
+}
+
+// Component returns the status of the named component.
+func (r HealthReport) Component(name string) (ComponentStatus, bool) {
+	for _, c := range r.Components {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return ComponentStatus{}, false
+}
+
+// Unhealthy returns the names of the unhealthy components.
+func (r HealthReport) Unhealthy() []string {
+	var names []string
+	for _, c := range r.Components {
+		if !c.Healthy {
+			names = append(names, c.Name)
+		}
+	}
+	return names
+}
+
+// CanSequence returns true if every component needed to produce blocks is healthy. A failing
+// op-batcher alone does not prevent sequencing, as batches can be posted once it recovers.
+func (r HealthReport) CanSequence() bool {
+	for _, c := range r.Components {
+		if !c.Healthy && c.Name != ComponentBatcher {
+			return false
+		}
+	}
+	return true
+}
+
+func (r HealthReport) String() string {
+	parts := make([]string, 0, len(r.Components))
+	for _, c := range r.Components {
+		if c.Healthy {
+			parts = append(parts, fmt.Sprintf("%s=healthy(%s)", c.Name, c.Latency.Truncate(time.Millisecond)))
+		} else {
+			parts = append(parts, fmt.Sprintf("%s=unhealthy(%s)", c.Name, c.Error))
+		}
+	}
+	return fmt.Sprintf("healthy=%t %s", r.Healthy, strings.Join(parts, " "))
+}
+
+// reporter damps raw check results per component and turns them into HealthReports.
+type reporter struct {
+	cfg        config.HealthConfig
+	hysteresis map[string]*Hysteresis
+}
+
+func newReporter(cfg config.HealthConfig) *reporter {
+	return &reporter{
+		cfg:        cfg,
+		hysteresis: make(map[string]*Hysteresis),
+	}
+}
+
+// report builds a HealthReport from raw results, whose Healthy field is the outcome of the
+// last check only.
+func (r *reporter) report(results []ComponentStatus) HealthReport {
+	report := HealthReport{
+		Healthy:    true,
+		Components: results,
+		Timestamp:  time.Now(),
+	}
+	for i, c := range results {
+		h, ok := r.hysteresis[c.Name]
+		if !ok {
+			h = NewHysteresis(r.cfg.FailureThreshold, r.cfg.SuccessThreshold)
+			r.hysteresis[c.Name] = h
+		}
+		report.Components[i].Healthy = h.Observe(c.Healthy)
+		report.Healthy = report.Healthy && report.Components[i].Healthy
+	}
+	return report
+}
@@ -0,0 +1,100 @@
+package leader
+
+import (
+	"context"
+	"time"
+
+	"github.com/base-org/leader-election/leader/audit"
+	"github.com/base-org/leader-election/leader/metrics"
+)
+
+// maxLeaseExpiries is how many leases in a row may go by unconfirmed before the leader hands
+// leadership over, so that a leader that stays raft leader without reaching a quorum in time
+// does not leave the cluster without a sequencer.
+const maxLeaseExpiries = 3
+
+// leaseCheck is the outcome of a raft.VerifyLeader call started at start.
+type leaseCheck struct {
+	start time.Time
+	err   error
+}
+
+// watchLease makes the leader confirm it still reaches a quorum every half lease with
+// raft.VerifyLeader. A leader cut off from the cluster only learns it lost leadership once
+// raft steps down, so when a whole lease goes by without a confirmation the state machine
+// is told leadership is lost, and stops the batcher and sequencer right away. Sequencing
+// resumes if the lease is renewed while still leader, see syncLeader. If it is still not
+// renewed after maxLeaseExpiries leases, leadership is handed over.
+func (e *Elector) watchLease(ctx context.Context) {
+	lease := e.config.RaftConfig.LeaderLeaseTimeout
+	ticker := time.NewTicker(lease / 2)
+	defer ticker.Stop()
+
+	checks := make(chan leaseCheck, 1)
+	verifying := false
+	// term is when the current leadership started, renewed when the lease was last confirmed,
+	// and expired when it was found expired, or leadership was last handed over since.
+	var term, renewed, expired time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !e.leader.Load() {
+				continue
+			}
+			if since := e.leaderSince.Load(); !since.Equal(term) {
+				term, renewed = since, since
+			}
+
+			if !verifying {
+				verifying = true
+				go func(start time.Time) {
+					checks <- leaseCheck{start: start, err: e.raft.VerifyLeader().Error()}
+				}(time.Now())
+			}
+
+			if !e.leaseExpired.Load() && time.Since(renewed) > lease {
+				e.log.Warn("leader lease expired, stopping sequencer", "unconfirmed", time.Since(renewed).Truncate(time.Millisecond), "term", e.consensus.Term())
+				e.leaseExpired.Store(true)
+				e.recordLease("expired")
+				e.syncLeader()
+				expired = time.Now()
+			}
+			if e.leaseExpired.Load() && time.Since(expired) >= (maxLeaseExpiries-1)*lease && e.hasOtherVoters() {
+				e.log.Warn("leader lease not renewed, handing leadership over", "unconfirmed", time.Since(renewed).Truncate(time.Millisecond), "term", e.consensus.Term())
+				e.metrics.RecordLeadershipTransfer(metrics.TransferLease)
+				if err := e.transferLeadership(ctx, audit.ReasonLease, metrics.TransferLease); err != nil {
+					e.log.Error("failed to hand leadership over", "err", err)
+				}
+				expired = time.Now()
+			}
+		case check := <-checks:
+			verifying = false
+			if check.err != nil {
+				e.log.Warn("failed to verify leadership", "err", check.err)
+				continue
+			}
+			if check.start.After(renewed) {
+				renewed = check.start
+			}
+			if e.leaseExpired.Load() && time.Since(renewed) <= lease {
+				e.log.Info("leader lease renewed, resuming sequencing", "term", e.consensus.Term())
+				e.leaseExpired.Store(false)
+				e.recordLease("renewed")
+				e.syncLeader()
+			}
+		}
+	}
+}
+
+// recordLease records a change of the leader lease in the audit log.
+func (e *Elector) recordLease(lease string) {
+	e.audit.Record(audit.Entry{
+		Term:   e.consensus.Term(),
+		Event:  audit.EventLeadership,
+		Reason: audit.ReasonElection,
+		Params: map[string]string{"lease": lease},
+	})
+}
@@ -0,0 +1,102 @@
+package leader
+
+import (
+	"github.com/base-org/leader-election/leader/fsm"
+	"github.com/hashicorp/raft"
+)
+
+// reconcileMembership demotes the voters that reported they cannot sequence to non-voters,
+// so that they cannot win an election, and promotes them back once they report healthy.
+// Only the leader can change the raft configuration, so it does so on behalf of the
+// followers. Demoted servers are recorded in the FSM, so that a new leader only promotes
+// the servers demoted for their health and not the ones an operator added as non-voters.
+func (e *Elector) reconcileMembership() {
+	future := e.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		e.log.Warn("failed to get raft configuration", "err", err)
+		return
+	}
+	servers := future.Configuration().Servers
+	index := future.Index()
+
+	voters := 0
+	known := make(map[string]bool, len(servers))
+	for _, srv := range servers {
+		known[string(srv.ID)] = true
+		if srv.Suffrage == raft.Voter {
+			voters++
+		}
+	}
+
+	// Forget the demoted servers that were removed from the cluster.
+	for _, id := range e.fsm.Demoted() {
+		if !known[id] {
+			e.applyDemoted(id, false)
+		}
+	}
+
+	for _, srv := range servers {
+		if srv.ID == e.config.RaftConfig.LocalID {
+			// An unhealthy leader transfers leadership instead, see handleUnhealthy.
+			continue
+		}
+		status, ok := e.peers.Get(string(srv.ID), e.consensus.peerStatusMaxAge)
+		if !ok {
+			continue
+		}
+		demoted := e.fsm.IsDemoted(string(srv.ID))
+		healthy := status.Report.CanSequence()
+
+		switch {
+		case srv.Suffrage == raft.Voter && !healthy:
+			if voters <= e.config.Health.MinVoters {
+				e.log.Warn("server is unhealthy but too few voters are left to demote it", "server", srv.ID, "voters", voters)
+				continue
+			}
+			e.log.Warn("server is unhealthy, demoting it to non-voter", "server", srv.ID, "term", e.consensus.Term())
+			if !e.applyDemoted(string(srv.ID), true) {
+				continue
+			}
+			f := e.raft.DemoteVoter(srv.ID, index, membershipTimeout)
+			if err := f.Error(); err != nil {
+				e.log.Error("failed to demote server", "server", srv.ID, "err", err)
+				return
+			}
+			index = f.Index()
+			voters--
+		case srv.Suffrage == raft.Voter && demoted:
+			// The server was promoted back but the FSM was not updated.
+			e.applyDemoted(string(srv.ID), false)
+		case srv.Suffrage == raft.Nonvoter && demoted && healthy:
+			e.log.Info("server is healthy again, promoting it to voter", "server", srv.ID, "term", e.consensus.Term())
+			f := e.raft.AddVoter(srv.ID, srv.Address, index, membershipTimeout)
+			if err := f.Error(); err != nil {
+				e.log.Error("failed to promote server", "server", srv.ID, "err", err)
+				return
+			}
+			index = f.Index()
+			voters++
+			e.applyDemoted(string(srv.ID), false)
+		}
+	}
+}
+
+// applyDemoted records in the FSM whether the server is demoted for its health, and
+// returns true if it succeeded.
+func (e *Elector) applyDemoted(id string, demoted bool) bool {
+	var cmd []byte
+	var err error
+	if demoted {
+		cmd, err = fsm.NewMarkDemoted(id)
+	} else {
+		cmd, err = fsm.NewClearDemoted(id)
+	}
+	if err == nil {
+		err = e.consensus.apply(cmd)
+	}
+	if err != nil {
+		e.log.Error("failed to record demotion", "server", id, "demoted", demoted, "err", err)
+		return false
+	}
+	return true
+}
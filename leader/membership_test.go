@@ -0,0 +1,149 @@
+package leader
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/base-org/leader-election/leader/cluster"
+	"github.com/base-org/leader-election/leader/config"
+	"github.com/base-org/leader-election/leader/fsm"
+	lh "github.com/base-org/leader-election/leader/health"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+)
+
+// newTestCluster starts an in-memory raft cluster of n voters and returns an elector on its
+// leader, with only what reconcileMembership needs.
+func newTestCluster(t *testing.T, n int, minVoters int) *Elector {
+	t.Helper()
+	log := hclog.NewNullLogger()
+
+	var (
+		servers    []raft.Server
+		transports []*raft.InmemTransport
+	)
+	for i := 0; i < n; i++ {
+		addr, trans := raft.NewInmemTransport("")
+		transports = append(transports, trans)
+		servers = append(servers, raft.Server{ID: raft.ServerID(fmt.Sprintf("node-%d", i)), Address: addr, Suffrage: raft.Voter})
+	}
+	for _, a := range transports {
+		for _, b := range transports {
+			a.Connect(b.LocalAddr(), b)
+		}
+	}
+
+	nodes := make(map[raft.ServerID]*raft.Raft, n)
+	fsms := make(map[raft.ServerID]*fsm.UnsafeHeadFSM, n)
+	for i, srv := range servers {
+		cfg := raft.DefaultConfig()
+		cfg.LocalID = srv.ID
+		cfg.Logger = log
+		cfg.HeartbeatTimeout = 50 * time.Millisecond
+		cfg.ElectionTimeout = 50 * time.Millisecond
+		cfg.LeaderLeaseTimeout = 50 * time.Millisecond
+		store := raft.NewInmemStore()
+		f := fsm.New()
+		if err := raft.BootstrapCluster(cfg, store, store, raft.NewInmemSnapshotStore(), transports[i], raft.Configuration{Servers: servers}); err != nil {
+			t.Fatalf("failed to bootstrap %s: %v", srv.ID, err)
+		}
+		r, err := raft.NewRaft(cfg, f, store, store, raft.NewInmemSnapshotStore(), transports[i])
+		if err != nil {
+			t.Fatalf("failed to start %s: %v", srv.ID, err)
+		}
+		t.Cleanup(func() { r.Shutdown().Error() })
+		nodes[srv.ID], fsms[srv.ID] = r, f
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		for id, r := range nodes {
+			if r.State() != raft.Leader {
+				continue
+			}
+			rc := raft.DefaultConfig()
+			rc.LocalID = id
+			e := &Elector{
+				log:    log,
+				config: &config.Config{RaftConfig: rc, Health: config.HealthConfig{MinVoters: minVoters}},
+				raft:   r,
+				fsm:    fsms[id],
+				peers:  cluster.NewRegistry(),
+			}
+			e.consensus = &raftConsensus{log: log, raft: r, fsm: e.fsm, localID: id, peers: e.peers, peerStatusMaxAge: time.Minute}
+			return e
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no leader elected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// report records the health of every follower in the elector registry.
+func report(t *testing.T, e *Elector, healthy bool) {
+	for _, srv := range suffrages(t, e) {
+		if srv.ID == e.config.RaftConfig.LocalID {
+			continue
+		}
+		e.peers.Update(cluster.PeerStatus{
+			ID:     string(srv.ID),
+			Report: lh.HealthReport{Healthy: healthy, Components: []lh.ComponentStatus{{Name: lh.ComponentNode, Healthy: healthy}}},
+		})
+	}
+}
+
+func suffrages(t *testing.T, e *Elector) []raft.Server {
+	future := e.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		t.Fatalf("failed to get raft configuration: %v", err)
+	}
+	return future.Configuration().Servers
+}
+
+func voters(t *testing.T, e *Elector) int {
+	n := 0
+	for _, srv := range suffrages(t, e) {
+		if srv.Suffrage == raft.Voter {
+			n++
+		}
+	}
+	return n
+}
+
+func TestReconcileMembership(t *testing.T) {
+	tests := []struct {
+		name       string
+		nodes      int
+		minVoters  int
+		wantVoters int
+	}{
+		{name: "demotes unhealthy followers down to the floor", nodes: 3, minVoters: 2, wantVoters: 2},
+		{name: "demotes every unhealthy follower above the floor", nodes: 5, minVoters: 2, wantVoters: 2},
+		{name: "keeps voters at the floor", nodes: 3, minVoters: 3, wantVoters: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestCluster(t, tt.nodes, tt.minVoters)
+
+			report(t, e, false)
+			e.reconcileMembership()
+			if got := voters(t, e); got != tt.wantVoters {
+				t.Fatalf("voters = %d after demotion, want %d", got, tt.wantVoters)
+			}
+			if got := len(e.fsm.Demoted()); got != tt.nodes-tt.wantVoters {
+				t.Errorf("demoted = %v, want %d servers", e.fsm.Demoted(), tt.nodes-tt.wantVoters)
+			}
+
+			report(t, e, true)
+			e.reconcileMembership()
+			if got := voters(t, e); got != tt.nodes {
+				t.Errorf("voters = %d after recovery, want %d", got, tt.nodes)
+			}
+			if got := e.fsm.Demoted(); len(got) != 0 {
+				t.Errorf("demoted = %v after recovery, want none", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package metrics
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	gometrics "github.com/armon/go-metrics"
+	gmprom "github.com/armon/go-metrics/prometheus"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "leader_elector"
+
+// Causes of a leadership transfer.
+const (
+	TransferUnhealthy = "unhealthy"
+	TransferFenced    = "fenced"
+	TransferShutdown  = "shutdown"
+	TransferOperator  = "operator"
+	TransferLease     = "lease"
+)
+
+// Sequencer status mismatches found by the reconciliation loop.
+const (
+	MismatchActiveOnFollower = "active_on_follower"
+	MismatchInactiveOnLeader = "inactive_on_leader"
+)
+
+// Metrics holds the Prometheus metrics of the elector. Its methods are safe for concurrent
+// use, and so is a nil *Metrics, which records nothing.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	leader       prometheus.Gauge
+	state        *prometheus.GaugeVec
+	term         prometheus.Gauge
+	commitIndex  prometheus.Gauge
+	appliedIndex prometheus.Gauge
+	lastContact  prometheus.Gauge
+	transfers    *prometheus.CounterVec
+	healthy      *prometheus.GaugeVec
+	checkLatency *prometheus.HistogramVec
+	rpcCalls     *prometheus.CounterVec
+	rpcErrors    *prometheus.CounterVec
+	rpcLatency   *prometheus.HistogramVec
+	mismatches   *prometheus.CounterVec
+	knownStates  []string
+}
+
+// New creates the elector metrics and bridges the armon/go-metrics output of raft, whose
+// names already start with "raft", into the same registry.
+func New(states []string) (*Metrics, error) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector())
+	registry.MustRegister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+
+	m := &Metrics{
+		registry: registry,
+		leader: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "is_leader",
+			Help:      "1 if this node is the raft leader, 0 otherwise.",
+		}),
+		state: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "sequencer_state",
+			Help:      "1 for the current state of the local sequencer state machine, 0 for the others.",
+		}, []string{"state"}),
+		term: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "raft_term",
+			Help:      "The current raft term.",
+		}),
+		commitIndex: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "raft_commit_index",
+			Help:      "The index of the last committed raft log.",
+		}),
+		appliedIndex: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "raft_applied_index",
+			Help:      "The index of the last raft log applied to the FSM.",
+		}),
+		lastContact: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "raft_last_contact_seconds",
+			Help:      "Seconds since the last contact with the leader, 0 on the leader.",
+		}),
+		transfers: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "leadership_transfers_total",
+			Help:      "Leadership transfers started by this node, by cause.",
+		}, []string{"cause"}),
+		healthy: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "component_healthy",
+			Help:      "1 if the component is healthy, 0 otherwise.",
+		}, []string{"component"}),
+		checkLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "health_check_duration_seconds",
+			Help:      "Latency of the health checks, by component.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"component"}),
+		rpcCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "control_rpc_calls_total",
+			Help:      "Control calls made to op-node, op-batcher and op-geth, by method.",
+		}, []string{"method"}),
+		rpcErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "control_rpc_errors_total",
+			Help:      "Failed control calls, by method.",
+		}, []string{"method"}),
+		rpcLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "control_rpc_duration_seconds",
+			Help:      "Latency of the control calls, by method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method"}),
+		mismatches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "sequencer_mismatches_total",
+			Help:      "Times the sequencer status did not match the leadership status, by kind.",
+		}, []string{"kind"}),
+		knownStates: states,
+	}
+	registry.MustRegister(
+		m.leader, m.state, m.term, m.commitIndex, m.appliedIndex, m.lastContact, m.transfers,
+		m.healthy, m.checkLatency, m.rpcCalls, m.rpcErrors, m.rpcLatency, m.mismatches,
+	)
+
+	sink, err := gmprom.NewPrometheusSinkFrom(gmprom.PrometheusOpts{
+		Registerer: registry,
+		Expiration: time.Minute,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create go-metrics prometheus sink")
+	}
+	cfg := gometrics.DefaultConfig("")
+	cfg.EnableHostname = false
+	cfg.EnableRuntimeMetrics = false
+	if _, err := gometrics.NewGlobal(cfg, sink); err != nil {
+		return nil, errors.Wrap(err, "failed to bridge go-metrics")
+	}
+	return m, nil
+}
+
+// Serve exposes the metrics on addr under /metrics until ctx is cancelled.
+func (m *Metrics) Serve(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+	srv := &http.Server{Handler: mux}
+
+	sock, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errors.Wrap(err, "failed to listen for metrics")
+	}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	if err := srv.Serve(sock); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return errors.Wrap(err, "failed to serve metrics")
+	}
+	return nil
+}
+
+// RecordLeader records whether this node is the raft leader.
+func (m *Metrics) RecordLeader(leader bool) {
+	if m == nil {
+		return
+	}
+	m.leader.Set(boolToFloat(leader))
+}
+
+// RecordState records the state of the local sequencer state machine.
+func (m *Metrics) RecordState(state string) {
+	if m == nil {
+		return
+	}
+	for _, s := range m.knownStates {
+		m.state.WithLabelValues(s).Set(boolToFloat(s == state))
+	}
+}
+
+// RecordRaft records the raft term, commit and applied indexes, and the time since the
+// last contact with the leader.
+func (m *Metrics) RecordRaft(term, commitIndex, appliedIndex uint64, lastContact time.Duration) {
+	if m == nil {
+		return
+	}
+	m.term.Set(float64(term))
+	m.commitIndex.Set(float64(commitIndex))
+	m.appliedIndex.Set(float64(appliedIndex))
+	m.lastContact.Set(lastContact.Seconds())
+}
+
+// RecordLeadershipTransfer counts a leadership transfer started for the given cause.
+func (m *Metrics) RecordLeadershipTransfer(cause string) {
+	if m == nil {
+		return
+	}
+	m.transfers.WithLabelValues(cause).Inc()
+}
+
+// RecordComponentHealth records the health of a component and the latency of its check.
+func (m *Metrics) RecordComponentHealth(component string, healthy bool, latency time.Duration) {
+	if m == nil {
+		return
+	}
+	m.healthy.WithLabelValues(component).Set(boolToFloat(healthy))
+	m.checkLatency.WithLabelValues(component).Observe(latency.Seconds())
+}
+
+// RecordControlCall records a control call made to op-node, op-batcher or op-geth.
+func (m *Metrics) RecordControlCall(method string, latency time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.rpcCalls.WithLabelValues(method).Inc()
+	m.rpcLatency.WithLabelValues(method).Observe(latency.Seconds())
+	if err != nil {
+		m.rpcErrors.WithLabelValues(method).Inc()
+	}
+}
+
+// RecordSequencerMismatch counts a sequencer status that did not match the leadership.
+func (m *Metrics) RecordSequencerMismatch(kind string) {
+	if m == nil {
+		return
+	}
+	m.mismatches.WithLabelValues(kind).Inc()
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,257 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/atomic"
+)
+
+var tracer = otel.Tracer("github.com/base-org/leader-election/leader/rpc")
+
+// Client is a JSON-RPC 2.0 client over HTTP. It is safe for concurrent use.
+type Client struct {
+	url      string
+	client   *http.Client
+	timeouts Timeouts
+	nextID   *atomic.Uint64
+	log      hclog.Logger
+}
+
+func NewClient(url string, timeouts Timeouts, log hclog.Logger) *Client {
+	return &Client{
+		url:      url,
+		client:   &http.Client{},
+		timeouts: timeouts,
+		nextID:   atomic.NewUint64(0),
+		log:      log.With("url", url),
+	}
+}
+
+// BatchElem is a single call of a batch request.
+type BatchElem struct {
+	Method string
+	Params []any
+	// Result is decoded from the response unless nil.
+	Result any
+	// Error is set after BatchCall if this call failed.
+	Error error
+}
+
+// Call invokes method with params and decodes its result into result, unless result is
+// nil. The call is bounded by the timeout configured for the method, and carries the
+// fencing token of ctx, if any, see WithFencingToken, and the trace context of ctx. It returns a
+// *TransportError, *HTTPStatusError, *JSONRPCError or *DecodeError when it did not succeed.
+func (c *Client) Call(ctx context.Context, method string, params []any, result any) error {
+	ctx, span := c.startSpan(ctx, method, attribute.String("rpc.method", method))
+	defer span.End()
+
+	start := time.Now()
+	err := c.call(ctx, method, params, result)
+	recordError(span, err)
+	if err != nil {
+		c.log.Debug("rpc call failed", "method", method, "duration", time.Since(start), "err", err)
+	} else {
+		c.log.Trace("rpc call", "method", method, "duration", time.Since(start))
+	}
+	return err
+}
+
+func (c *Client) call(ctx context.Context, method string, params []any, result any) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeouts.For(method))
+	defer cancel()
+
+	req := c.newRequest(method, params)
+	body, err := c.post(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	var resp JSONRPCResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return &DecodeError{Body: body, Err: err}
+	}
+	if resp.ID != req.ID {
+		return &DecodeError{Body: body, Err: errors.Errorf("unexpected response id %d, expected %d", resp.ID, req.ID)}
+	}
+	return decodeResult(resp, result)
+}
+
+// BatchCall sends all calls in a single request. The returned error is only set if the
+// whole batch failed, the outcome of each call is set in its BatchElem.Error. The batch is
+// bounded by the longest timeout configured for its methods.
+func (c *Client) BatchCall(ctx context.Context, elems []BatchElem) error {
+	if len(elems) == 0 {
+		return nil
+	}
+
+	timeout := c.timeouts.For(elems[0].Method)
+	reqs := make([]JSONRPCRequest, len(elems))
+	byID := make(map[uint64]int, len(elems))
+	for i, elem := range elems {
+		reqs[i] = c.newRequest(elem.Method, elem.Params)
+		byID[reqs[i].ID] = i
+		if t := c.timeouts.For(elem.Method); t > timeout {
+			timeout = t
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	methods := make([]string, len(elems))
+	for i, elem := range elems {
+		methods[i] = elem.Method
+	}
+	ctx, span := c.startSpan(ctx, "batch", attribute.StringSlice("rpc.methods", methods))
+	defer span.End()
+
+	start := time.Now()
+	body, err := c.post(ctx, reqs)
+	recordError(span, err)
+	if err != nil {
+		c.log.Debug("rpc batch failed", "calls", len(elems), "duration", time.Since(start), "err", err)
+		return err
+	}
+	c.log.Trace("rpc batch", "calls", len(elems), "duration", time.Since(start))
+
+	var resps []JSONRPCResponse
+	if err := json.Unmarshal(body, &resps); err != nil {
+		// Servers reject a malformed batch with a single error response.
+		var resp JSONRPCResponse
+		if json.Unmarshal(body, &resp) == nil && resp.Error != nil {
+			return resp.Error
+		}
+		return &DecodeError{Body: body, Err: err}
+	}
+
+	for _, resp := range resps {
+		i, ok := byID[resp.ID]
+		if !ok {
+			return &DecodeError{Body: body, Err: errors.Errorf("unexpected or duplicate response id %d", resp.ID)}
+		}
+		elems[i].Error = decodeResult(resp, elems[i].Result)
+		delete(byID, resp.ID)
+	}
+	for _, i := range byID {
+		elems[i].Error = &DecodeError{Body: body, Err: errors.New("missing response")}
+	}
+	return nil
+}
+
+// Ping sends a GET request to the given path of the server and returns the status code.
+// The response body is always drained and closed.
+func (c *Client) Ping(ctx context.Context, path string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeouts.For(""))
+	defer cancel()
+
+	ctx, span := c.startSpan(ctx, "GET "+path, attribute.String("http.route", path))
+	defer span.End()
+
+	code, err := c.ping(ctx, path)
+	recordError(span, err)
+	span.SetAttributes(attribute.Int("http.status_code", code))
+	return code, err
+}
+
+func (c *Client) ping(ctx context.Context, path string) (int, error) {
+	url := c.url + path
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return 0, &TransportError{URL: url, Err: err}
+	}
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
+
+// startSpan starts a client span for a call to the server.
+func (c *Client) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs, attribute.String("rpc.system", "jsonrpc"), attribute.String("server.address", c.url))
+	return tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// recordError marks the span as failed if the call returned an error.
+func recordError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+func (c *Client) newRequest(method string, params []any) JSONRPCRequest {
+	if params == nil {
+		params = []any{}
+	}
+	return JSONRPCRequest{
+		Version: DefaultJsonRPCVersion,
+		Method:  method,
+		Params:  params,
+		ID:      c.nextID.Inc(),
+	}
+}
+
+// post sends the JSON encoded payload and returns the response body of a successful
+// request. The response body is always closed.
+func (c *Client) post(ctx context.Context, payload any) ([]byte, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal json request")
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", ContentTypeApplicationJSON)
+	if token, ok := FencingTokenFrom(ctx); ok {
+		httpReq.Header.Set(FencingTokenHeader, token.String())
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(httpReq.Header))
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, &TransportError{URL: c.url, Err: err}
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &TransportError{URL: c.url, Err: err}
+	}
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return nil, &HTTPStatusError{URL: c.url, StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	return body, nil
+}
+
+func decodeResult(resp JSONRPCResponse, result any) error {
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(resp.Result, result); err != nil {
+		return &DecodeError{Body: resp.Result, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,324 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// newServer serves every request with respond, given the raw request body.
+func newServer(t *testing.T, respond func(w http.ResponseWriter, body []byte)) *Client {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("failed to read request: %v", err)
+		}
+		respond(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return NewClient(srv.URL, Timeouts{Default: time.Second}, hclog.NewNullLogger())
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", ContentTypeApplicationJSON)
+	json.NewEncoder(w).Encode(v)
+}
+
+// echo answers a single call with result.
+func echo(result string) func(w http.ResponseWriter, body []byte) {
+	return func(w http.ResponseWriter, body []byte) {
+		var req JSONRPCRequest
+		json.Unmarshal(body, &req)
+		writeJSON(w, JSONRPCResponse{Version: DefaultJsonRPCVersion, ID: req.ID, Result: json.RawMessage(result)})
+	}
+}
+
+func TestCall(t *testing.T) {
+	c := newServer(t, echo(`"0x2a"`))
+
+	var result string
+	if err := c.Call(context.Background(), "eth_blockNumber", nil, &result); err != nil {
+		t.Fatalf("Call() = %v", err)
+	}
+	if result != "0x2a" {
+		t.Errorf("result = %s, want 0x2a", result)
+	}
+}
+
+func TestCallErrors(t *testing.T) {
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	tests := []struct {
+		name string
+		// respond is nil to call a server that is down.
+		respond         func(w http.ResponseWriter, body []byte)
+		result          any
+		wantType        any
+		wantUnavailable bool
+	}{
+		{
+			name:            "server down",
+			wantType:        &TransportError{},
+			wantUnavailable: true,
+		},
+		{
+			name: "server error status",
+			respond: func(w http.ResponseWriter, body []byte) {
+				http.Error(w, "overloaded", http.StatusServiceUnavailable)
+			},
+			wantType:        &HTTPStatusError{},
+			wantUnavailable: true,
+		},
+		{
+			name: "client error status",
+			respond: func(w http.ResponseWriter, body []byte) {
+				http.Error(w, "bad request", http.StatusBadRequest)
+			},
+			wantType: &HTTPStatusError{},
+		},
+		{
+			name: "malformed body",
+			respond: func(w http.ResponseWriter, body []byte) {
+				w.Write([]byte(`{"jsonrpc":`))
+			},
+			wantType: &DecodeError{},
+		},
+		{
+			name: "response id mismatch",
+			respond: func(w http.ResponseWriter, body []byte) {
+				writeJSON(w, JSONRPCResponse{Version: DefaultJsonRPCVersion, ID: 1000, Result: json.RawMessage(`true`)})
+			},
+			wantType: &DecodeError{},
+		},
+		{
+			name:     "malformed result",
+			respond:  echo(`{"not":"a string"}`),
+			result:   new(string),
+			wantType: &DecodeError{},
+		},
+		{
+			name: "json-rpc error",
+			respond: func(w http.ResponseWriter, body []byte) {
+				var req JSONRPCRequest
+				json.Unmarshal(body, &req)
+				writeJSON(w, JSONRPCResponse{Version: DefaultJsonRPCVersion, ID: req.ID, Error: &JSONRPCError{Code: -32601, Message: "method not found"}})
+			},
+			wantType: &JSONRPCError{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient(unreachable.URL, Timeouts{Default: time.Second}, hclog.NewNullLogger())
+			if tt.respond != nil {
+				c = newServer(t, tt.respond)
+			}
+
+			err := c.Call(context.Background(), "eth_blockNumber", nil, tt.result)
+			if err == nil {
+				t.Fatalf("Call() = nil, want %T", tt.wantType)
+			}
+			if !errorAs(err, tt.wantType) {
+				t.Errorf("Call() = %T (%v), want %T", err, err, tt.wantType)
+			}
+			if got := IsUnavailable(err); got != tt.wantUnavailable {
+				t.Errorf("IsUnavailable(%v) = %t, want %t", err, got, tt.wantUnavailable)
+			}
+		})
+	}
+}
+
+// errorAs returns true if err is of the type of target, a pointer to an error type.
+func errorAs(err error, target any) bool {
+	switch target.(type) {
+	case *TransportError:
+		var e *TransportError
+		return errors.As(err, &e)
+	case *HTTPStatusError:
+		var e *HTTPStatusError
+		return errors.As(err, &e)
+	case *DecodeError:
+		var e *DecodeError
+		return errors.As(err, &e)
+	case *JSONRPCError:
+		_, ok := AsJSONRPCError(err)
+		return ok
+	}
+	return false
+}
+
+func TestCallTimeout(t *testing.T) {
+	c := newServer(t, func(w http.ResponseWriter, body []byte) {
+		time.Sleep(200 * time.Millisecond)
+	})
+	c.timeouts = Timeouts{Default: time.Second, Methods: map[string]time.Duration{"slow": 10 * time.Millisecond}}
+
+	err := c.Call(context.Background(), "slow", nil, nil)
+	var terr *TransportError
+	if !errors.As(err, &terr) || !IsUnavailable(err) {
+		t.Fatalf("Call() = %v, want an unavailable transport error", err)
+	}
+}
+
+func TestCallFencingToken(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get(FencingTokenHeader))
+		var req JSONRPCRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		writeJSON(w, JSONRPCResponse{Version: DefaultJsonRPCVersion, ID: req.ID, Result: json.RawMessage(`null`)})
+	}))
+	defer srv.Close()
+	c := NewClient(srv.URL, Timeouts{}, hclog.NewNullLogger())
+
+	token := FencingToken{Term: 3, Index: 7}
+	if err := c.Call(WithFencingToken(context.Background(), token), "admin_startSequencer", nil, nil); err != nil {
+		t.Fatalf("Call() = %v", err)
+	}
+	if err := c.Call(context.Background(), "admin_sequencerActive", nil, nil); err != nil {
+		t.Fatalf("Call() = %v", err)
+	}
+	if len(got) != 2 || got[0] != token.String() || got[1] != "" {
+		t.Errorf("%s headers = %q, want [%q \"\"]", FencingTokenHeader, got, token.String())
+	}
+}
+
+// batchServer answers a batch with respond, given the IDs of the requests.
+func batchServer(t *testing.T, respond func(ids []uint64) []JSONRPCResponse) *Client {
+	return newServer(t, func(w http.ResponseWriter, body []byte) {
+		var reqs []JSONRPCRequest
+		if err := json.Unmarshal(body, &reqs); err != nil {
+			t.Errorf("failed to decode batch: %v", err)
+		}
+		ids := make([]uint64, len(reqs))
+		for i, req := range reqs {
+			ids[i] = req.ID
+		}
+		writeJSON(w, respond(ids))
+	})
+}
+
+func ok(id uint64, result string) JSONRPCResponse {
+	return JSONRPCResponse{Version: DefaultJsonRPCVersion, ID: id, Result: json.RawMessage(result)}
+}
+
+func newBatch() []BatchElem {
+	return []BatchElem{
+		{Method: "optimism_syncStatus", Result: new(string)},
+		{Method: "admin_sequencerActive", Result: new(bool)},
+	}
+}
+
+func TestBatchCall(t *testing.T) {
+	// Responses may come in any order.
+	c := batchServer(t, func(ids []uint64) []JSONRPCResponse {
+		return []JSONRPCResponse{ok(ids[1], `true`), ok(ids[0], `"synced"`)}
+	})
+
+	batch := newBatch()
+	if err := c.BatchCall(context.Background(), batch); err != nil {
+		t.Fatalf("BatchCall() = %v", err)
+	}
+	for _, elem := range batch {
+		if elem.Error != nil {
+			t.Errorf("%s error = %v", elem.Method, elem.Error)
+		}
+	}
+	if got := *batch[0].Result.(*string); got != "synced" {
+		t.Errorf("%s = %s, want synced", batch[0].Method, got)
+	}
+	if got := *batch[1].Result.(*bool); !got {
+		t.Errorf("%s = false, want true", batch[1].Method)
+	}
+}
+
+func TestBatchCallMissingResponse(t *testing.T) {
+	c := batchServer(t, func(ids []uint64) []JSONRPCResponse {
+		return []JSONRPCResponse{ok(ids[0], `"synced"`)}
+	})
+
+	batch := newBatch()
+	if err := c.BatchCall(context.Background(), batch); err != nil {
+		t.Fatalf("BatchCall() = %v", err)
+	}
+	if batch[0].Error != nil {
+		t.Errorf("%s error = %v, want nil", batch[0].Method, batch[0].Error)
+	}
+	var derr *DecodeError
+	if !errors.As(batch[1].Error, &derr) {
+		t.Errorf("%s error = %v, want a decode error", batch[1].Method, batch[1].Error)
+	}
+}
+
+func TestBatchCallInvalidResponses(t *testing.T) {
+	tests := []struct {
+		name    string
+		respond func(ids []uint64) []JSONRPCResponse
+	}{
+		{
+			name: "unexpected id",
+			respond: func(ids []uint64) []JSONRPCResponse {
+				return []JSONRPCResponse{ok(ids[0], `"synced"`), ok(ids[1]+100, `true`)}
+			},
+		},
+		{
+			name: "duplicate id",
+			respond: func(ids []uint64) []JSONRPCResponse {
+				return []JSONRPCResponse{ok(ids[0], `"synced"`), ok(ids[0], `"synced"`), ok(ids[1], `true`)}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := batchServer(t, tt.respond)
+
+			err := c.BatchCall(context.Background(), newBatch())
+			var derr *DecodeError
+			if !errors.As(err, &derr) {
+				t.Fatalf("BatchCall() = %v, want a decode error", err)
+			}
+			if IsUnavailable(err) {
+				t.Errorf("IsUnavailable(%v) = true, want false", err)
+			}
+		})
+	}
+}
+
+func TestBatchCallRejected(t *testing.T) {
+	c := newServer(t, func(w http.ResponseWriter, body []byte) {
+		writeJSON(w, JSONRPCResponse{Version: DefaultJsonRPCVersion, Error: &JSONRPCError{Code: -32600, Message: "invalid request"}})
+	})
+
+	err := c.BatchCall(context.Background(), newBatch())
+	if jerr, ok := AsJSONRPCError(err); !ok || jerr.Code != -32600 {
+		t.Fatalf("BatchCall() = %v, want the json-rpc error", err)
+	}
+}
+
+func TestParseTimeouts(t *testing.T) {
+	timeouts, err := ParseTimeouts(3*time.Second, []string{"admin_startSequencer=5s"})
+	if err != nil {
+		t.Fatalf("ParseTimeouts() = %v", err)
+	}
+	if got := timeouts.For("admin_startSequencer"); got != 5*time.Second {
+		t.Errorf("For(admin_startSequencer) = %s, want 5s", got)
+	}
+	if got := timeouts.For("optimism_syncStatus"); got != 3*time.Second {
+		t.Errorf("For(optimism_syncStatus) = %s, want 3s", got)
+	}
+
+	for _, o := range []string{"admin_startSequencer", "=5s", "admin_startSequencer=soon"} {
+		if _, err := ParseTimeouts(0, []string{o}); err == nil || !strings.Contains(err.Error(), "invalid") {
+			t.Errorf("ParseTimeouts(%q) = %v, want an error", o, err)
+		}
+	}
+}
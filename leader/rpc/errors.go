@@ -0,0 +1,71 @@
+package rpc
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// TransportError is returned when a request could not be sent or no response was received,
+// e.g. because the server is down or the call timed out.
+type TransportError struct {
+	URL string
+	Err error
+}
+
+func (e *TransportError) Error() string {
+	return fmt.Sprintf("transport error calling %s: %v", e.URL, e.Err)
+}
+
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+// HTTPStatusError is returned when the server answers with a non-2xx status code.
+type HTTPStatusError struct {
+	URL        string
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d from %s: %s", e.StatusCode, e.URL, e.Body)
+}
+
+// DecodeError is returned when a response or its result cannot be decoded.
+type DecodeError struct {
+	Body []byte
+	Err  error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("failed to decode response %q: %v", string(e.Body), e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// AsJSONRPCError returns the JSON-RPC error returned by the server, if any.
+func AsJSONRPCError(err error) (*JSONRPCError, bool) {
+	var jerr *JSONRPCError
+	if errors.As(err, &jerr) {
+		return jerr, true
+	}
+	return nil, false
+}
+
+// IsUnavailable returns true if the error means the server could not serve the request,
+// as opposed to the server rejecting it.
+func IsUnavailable(err error) bool {
+	var terr *TransportError
+	if errors.As(err, &terr) {
+		return true
+	}
+	var serr *HTTPStatusError
+	if errors.As(err, &serr) {
+		return serr.StatusCode >= http.StatusInternalServerError
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// FencingTokenHeader is the HTTP header carrying the fencing token of the calling leader, so
+// that op-node, or a proxy in front of it, can reject calls from a stale leader.
+const FencingTokenHeader = "X-Fencing-Token"
+
+// FencingToken identifies a leadership term. It is the raft term and the index of the first
+// log applied by the leader in that term, and strictly increases with every new leader.
+type FencingToken struct {
+	Term  uint64 `json:"term"`
+	Index uint64 `json:"index"`
+}
+
+// IsZero returns true if the token was never set.
+func (t FencingToken) IsZero() bool {
+	return t.Term == 0 && t.Index == 0
+}
+
+// Less returns true if t was issued to an older leader than o.
+func (t FencingToken) Less(o FencingToken) bool {
+	if t.Term != o.Term {
+		return t.Term < o.Term
+	}
+	return t.Index < o.Index
+}
+
+// String returns the token in the FencingTokenHeader format, i.e. term:index.
+func (t FencingToken) String() string {
+	return fmt.Sprintf("%d:%d", t.Term, t.Index)
+}
+
+// ParseFencingToken parses a token in the term:index format.
+func ParseFencingToken(s string) (FencingToken, error) {
+	term, index, ok := strings.Cut(s, ":")
+	if !ok {
+		return FencingToken{}, fmt.Errorf("invalid fencing token %q, expected term:index", s)
+	}
+	t, err := strconv.ParseUint(term, 10, 64)
+	if err != nil {
+		return FencingToken{}, errors.Wrapf(err, "invalid fencing token term %q", term)
+	}
+	i, err := strconv.ParseUint(index, 10, 64)
+	if err != nil {
+		return FencingToken{}, errors.Wrapf(err, "invalid fencing token index %q", index)
+	}
+	return FencingToken{Term: t, Index: i}, nil
+}
+
+type fencingTokenKey struct{}
+
+// WithFencingToken returns a context whose calls carry the token in the FencingTokenHeader.
+func WithFencingToken(ctx context.Context, token FencingToken) context.Context {
+	return context.WithValue(ctx, fencingTokenKey{}, token)
+}
+
+// FencingTokenFrom returns the token set with WithFencingToken, if any.
+func FencingTokenFrom(ctx context.Context) (FencingToken, bool) {
+	token, ok := ctx.Value(fencingTokenKey{}).(FencingToken)
+	return token, ok
+}
@@ -1,14 +1,14 @@
 package rpc
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
-	"net/http"
+	"strings"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/pkg/errors"
-	"golang.org/x/net/context"
 )
 
 const (
@@ -20,14 +20,14 @@ type JSONRPCRequest struct {
 	Version string `json:"jsonrpc"`
 	Method  string `json:"method"`
 	Params  []any  `json:"params"`
-	ID      int    `json:"id"`
+	ID      uint64 `json:"id"`
 }
 
 type JSONRPCResponse struct {
-	Version string        `json:"jsonrpc"`
-	ID      int           `json:"id"`
-	Result  any           `json:"result,omitempty"`
-	Error   *JSONRPCError `json:"error,omitempty"`
+	Version string          `json:"jsonrpc"`
+	ID      uint64          `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *JSONRPCError   `json:"error,omitempty"`
 }
 
 type JSONRPCError struct {
@@ -46,8 +46,9 @@ func (j JSONRPCError) Error() string {
 
 // Block represents the Ethereum block JSON structure returned by eth_getBlockByX.
 type Block struct {
-	// Number           string   `json:"number"`
-	Hash string `json:"hash"`
+	Number    hexutil.Uint64 `json:"number"`
+	Hash      common.Hash    `json:"hash"`
+	Timestamp hexutil.Uint64 `json:"timestamp"`
 	// ParentHash       string   `json:"parentHash"`
 	// Nonce            string   `json:"nonce"`
 	// Sha3Uncles       string   `json:"sha3Uncles"`
@@ -62,30 +63,73 @@ type Block struct {
 	// Size             string   `json:"size"`
 	// GasLimit         string   `json:"gasLimit"`
 	// GasUsed          string   `json:"gasUsed"`
-	// Timestamp        string   `json:"timestamp"`
 	// Transactions     []any    `json:"transactions"`
 	// Uncles           []string `json:"uncles"`
 }
 
-func Post(c *http.Client, url string, req JSONRPCRequest) (*http.Response, error) {
-	data, err := json.Marshal(req)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to marshal json request")
-	}
+// BlockID identifies a block in the op-node API.
+type BlockID struct {
+	Hash   common.Hash `json:"hash"`
+	Number uint64      `json:"number"`
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	defer cancel()
+// L1BlockRef is an L1 block as returned by the op-node API.
+type L1BlockRef struct {
+	Hash      common.Hash `json:"hash"`
+	Number    uint64      `json:"number"`
+	Timestamp uint64      `json:"timestamp"`
+}
 
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(data))
-	if err != nil {
-		return nil, err
-	}
-	httpReq.Header.Set("Content-Type", ContentTypeApplicationJSON)
+// L2BlockRef is an L2 block as returned by the op-node API.
+type L2BlockRef struct {
+	Hash      common.Hash `json:"hash"`
+	Number    uint64      `json:"number"`
+	Timestamp uint64      `json:"timestamp"`
+	L1Origin  BlockID     `json:"l1origin"`
+}
+
+// SyncStatus is the subset of the op-node optimism_syncStatus result used by the elector.
+type SyncStatus struct {
+	CurrentL1 L1BlockRef `json:"current_l1"`
+	HeadL1    L1BlockRef `json:"head_l1"`
+	UnsafeL2  L2BlockRef `json:"unsafe_l2"`
+	SafeL2    L2BlockRef `json:"safe_l2"`
+}
 
-	resp, err := c.Do(httpReq)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to send request")
+// DefaultTimeout is the timeout of a call whose method has no specific timeout configured.
+const DefaultTimeout = 2 * time.Second
+
+// Timeouts configures the timeout of outbound calls per JSON-RPC method.
+type Timeouts struct {
+	Default time.Duration
+	Methods map[string]time.Duration
+}
+
+// For returns the timeout to use for calls to the given method.
+func (t Timeouts) For(method string) time.Duration {
+	if d, ok := t.Methods[method]; ok {
+		return d
 	}
+	if t.Default > 0 {
+		return t.Default
+	}
+	return DefaultTimeout
+}
 
-	return resp, nil
+// ParseTimeouts builds Timeouts from a default and a list of method=duration overrides,
+// e.g. "admin_startSequencer=5s".
+func ParseTimeouts(def time.Duration, overrides []string) (Timeouts, error) {
+	t := Timeouts{Default: def, Methods: make(map[string]time.Duration)}
+	for _, o := range overrides {
+		method, value, ok := strings.Cut(o, "=")
+		if !ok || method == "" {
+			return Timeouts{}, fmt.Errorf("invalid method timeout %q, expected method=duration", o)
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return Timeouts{}, errors.Wrapf(err, "invalid timeout for method %s", method)
+		}
+		t.Methods[method] = d
+	}
+	return t, nil
 }
@@ -0,0 +1,528 @@
+package leader
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/base-org/leader-election/leader/audit"
+	"github.com/base-org/leader-election/leader/control"
+	"github.com/base-org/leader-election/leader/fsm"
+	"github.com/base-org/leader-election/leader/metrics"
+	"github.com/base-org/leader-election/leader/rpc"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/hashicorp/go-hclog"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/atomic"
+)
+
+var tracer = otel.Tracer("github.com/base-org/leader-election/leader")
+
+// State is the state of the local sequencer as seen by the elector.
+type State int32
+
+const (
+	// StateFollower means the node is not the leader, or sequencing is paused, and its
+	// sequencer is stopped.
+	StateFollower State = iota
+	// StateBecomingLeader means the node won an election and is waiting for op-geth to
+	// catch up before starting its sequencer and batcher.
+	StateBecomingLeader
+	// StateLeading means the node is the leader and its sequencer is active.
+	StateLeading
+	// StateSteppingDown means the node is stopping its batcher and sequencer.
+	StateSteppingDown
+	// StateFenced means the node must not sequence, either because it could not take over
+	// as leader or because it could not confirm its sequencer stopped. It keeps handing
+	// leadership away and stopping the sequencer until both are true.
+	StateFenced
+)
+
+func (s State) String() string {
+	switch s {
+	case StateFollower:
+		return "follower"
+	case StateBecomingLeader:
+		return "becoming-leader"
+	case StateLeading:
+		return "leading"
+	case StateSteppingDown:
+		return "stepping-down"
+	case StateFenced:
+		return "fenced"
+	default:
+		return fmt.Sprintf("unknown(%d)", int32(s))
+	}
+}
+
+// stateNames returns the names of every state.
+func stateNames() []string {
+	var names []string
+	for s := StateFollower; s <= StateFenced; s++ {
+		names = append(names, s.String())
+	}
+	return names
+}
+
+// StateMachineConfig holds the retry and timeout settings of the StateMachine.
+type StateMachineConfig struct {
+	// CatchUpTimeout is how long a new leader waits for op-geth to reach the committed head.
+	CatchUpTimeout time.Duration
+	// MaxRetries is how many consecutive failed steps are tolerated before escalating.
+	MaxRetries int
+}
+
+// StateMachine reconciles the local sequencer and batcher with the raft leadership status.
+// Leadership changes are fed with SetLeader and Step is called on every event and on a
+// regular tick. Step must not be called concurrently, while State and SetLeader are safe
+// to call from any goroutine.
+type StateMachine struct {
+	cfg       StateMachineConfig
+	consensus Consensus
+	node      control.NodeRPC
+	batcher   control.BatcherRPC
+	geth      control.GethRPC
+	log       hclog.Logger
+	metrics   *metrics.Metrics
+	audit     *audit.Log
+
+	state   *atomic.Int32
+	since   time.Time
+	retries int
+	// token is the fencing token of the current leadership term, it is set once the new
+	// leader applied all committed logs and cleared when stepping down.
+	token rpc.FencingToken
+	// reason is the audit reason of the last transition.
+	reason string
+	// span traces the transitions from a stable state to the next, see traceTransition.
+	span trace.Span
+	// paused is the last sequencing pause status seen by shouldLead, and leadReason tells
+	// whether its last call saw it change.
+	paused     bool
+	leadReason string
+
+	mu     sync.Mutex
+	leader bool
+	// termCtx is cancelled as soon as leadership is lost, aborting in-flight calls made
+	// while taking over or leading, see leaderContext. It only carries the cancellation.
+	termCtx    context.Context
+	cancelTerm context.CancelFunc
+}
+
+func NewStateMachine(cfg StateMachineConfig, consensus Consensus, node control.NodeRPC, batcher control.BatcherRPC, geth control.GethRPC, log hclog.Logger, metrics *metrics.Metrics, auditLog *audit.Log) *StateMachine {
+	metrics.RecordState(StateFollower.String())
+	return &StateMachine{
+		cfg:       cfg,
+		consensus: consensus,
+		node:      node,
+		batcher:   batcher,
+		geth:      geth,
+		log:       log,
+		metrics:   metrics,
+		audit:     auditLog,
+		state:     atomic.NewInt32(int32(StateFollower)),
+		since:     time.Now(),
+	}
+}
+
+// State returns the current state, it is safe to call concurrently.
+func (m *StateMachine) State() State {
+	return State(m.state.Load())
+}
+
+// SetLeader records the latest raft leadership status of the local node. Losing leadership
+// cancels the calls made on behalf of the current term.
+func (m *StateMachine) SetLeader(leader bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.leader = leader
+	if !leader && m.cancelTerm != nil {
+		m.cancelTerm()
+		m.termCtx, m.cancelTerm = nil, nil
+	}
+}
+
+func (m *StateMachine) isLeader() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.leader
+}
+
+// leaderContext returns a context derived from ctx that is also cancelled when leadership
+// is lost, and must be cancelled once the step is done. It is already cancelled if
+// leadership was lost since the caller checked it.
+func (m *StateMachine) leaderContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	if !m.leader {
+		cancel()
+		return ctx, cancel
+	}
+	if m.termCtx == nil {
+		m.termCtx, m.cancelTerm = context.WithCancel(context.Background())
+	}
+	stop := context.AfterFunc(m.termCtx, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// Step performs a single reconciliation step from the current state. The steps taken until
+// the state machine settles as leader or follower are traced in a single span.
+func (m *StateMachine) Step(ctx context.Context) {
+	if m.span != nil {
+		ctx = trace.ContextWithSpan(ctx, m.span)
+	}
+	switch m.State() {
+	case StateFollower:
+		m.stepFollower(ctx)
+	case StateBecomingLeader:
+		m.stepBecomingLeader(ctx)
+	case StateLeading:
+		m.stepLeading(ctx)
+	case StateSteppingDown:
+		m.stepSteppingDown(ctx)
+	case StateFenced:
+		m.stepFenced(ctx)
+	}
+}
+
+// transition moves to a new state for the given audit reason, which is also the reason
+// recorded for the control calls made until the next transition.
+func (m *StateMachine) transition(ctx context.Context, to State, reason string) {
+	from := m.State()
+	if from == to {
+		return
+	}
+	m.logger().Info("sequencer state transition", "from", from.String(), "to", to.String(), "reason", reason)
+	m.traceTransition(ctx, from, to, reason)
+	m.audit.Record(audit.Entry{
+		Term:   m.consensus.Term(),
+		Event:  audit.EventTransition,
+		Reason: reason,
+		Params: map[string]string{"from": from.String(), "to": to.String()},
+	})
+	m.reason = reason
+	m.state.Store(int32(to))
+	m.metrics.RecordState(to.String())
+	m.since = time.Now()
+	m.retries = 0
+	if to == StateSteppingDown || to == StateFenced || to == StateFollower {
+		m.token = rpc.FencingToken{}
+	}
+}
+
+// traceTransition starts a span when the state machine leaves a stable state, records every
+// transition on it, and ends it once the state machine is leading or following again.
+func (m *StateMachine) traceTransition(ctx context.Context, from, to State, reason string) {
+	attrs := []attribute.KeyValue{
+		attribute.String("from", from.String()),
+		attribute.String("to", to.String()),
+		attribute.String("reason", reason),
+		attribute.Int64("term", int64(m.consensus.Term())),
+	}
+	if m.span == nil {
+		_, m.span = tracer.Start(ctx, "sequencer transition", trace.WithAttributes(attrs...))
+	}
+	m.span.AddEvent("transition", trace.WithAttributes(attrs...))
+	if to == StateLeading || to == StateFollower {
+		m.span.SetAttributes(attribute.String("state", to.String()))
+		m.span.End()
+		m.span = nil
+	}
+}
+
+// logger returns the logger of the state machine with the current state and raft term.
+func (m *StateMachine) logger() hclog.Logger {
+	return m.log.With("state", m.State().String(), "term", m.consensus.Term())
+}
+
+// retry records a failed step and reports whether the retry budget is exhausted.
+func (m *StateMachine) retry(err error) bool {
+	m.retries++
+	m.logger().Warn("step failed", "attempt", m.retries, "max-retries", m.cfg.MaxRetries, "err", err)
+	return m.retries > m.cfg.MaxRetries
+}
+
+// shouldLead returns true if the node is the leader and sequencing is not paused. It sets
+// leadReason to why this may have changed since the last call.
+func (m *StateMachine) shouldLead() bool {
+	paused := m.consensus.SequencingPaused()
+	if paused != m.paused {
+		m.paused = paused
+		m.leadReason = audit.ReasonOperator
+	} else {
+		m.leadReason = audit.ReasonElection
+	}
+	return m.isLeader() && !paused
+}
+
+func (m *StateMachine) stepFollower(ctx context.Context) {
+	if m.shouldLead() {
+		m.transition(ctx, StateBecomingLeader, m.leadReason)
+		m.Step(ctx)
+		return
+	}
+
+	active, err := m.node.SequencerActive(ctx)
+	if err != nil {
+		m.logger().Warn("failed to get sequencer status", "err", err)
+		return
+	}
+	if active {
+		m.logger().Warn("sequencer is active on a follower, stopping it")
+		m.metrics.RecordSequencerMismatch(metrics.MismatchActiveOnFollower)
+		m.transition(ctx, StateSteppingDown, audit.ReasonReconcile)
+		m.Step(ctx)
+	}
+}
+
+func (m *StateMachine) stepBecomingLeader(parent context.Context) {
+	if !m.shouldLead() {
+		m.transition(parent, StateSteppingDown, m.leadReason)
+		m.Step(parent)
+		return
+	}
+	ctx, cancel := m.leaderContext(parent)
+	defer cancel()
+
+	head, caughtUp, err := m.catchUp(ctx)
+	if err != nil {
+		m.logger().Error("failed to catch up to committed head, transferring leadership", "err", err)
+		m.transition(ctx, StateFenced, audit.ReasonReconcile)
+		m.Step(parent)
+		return
+	}
+	if !caughtUp {
+		if time.Since(m.since) > m.cfg.CatchUpTimeout {
+			m.logger().Error("timed out waiting for local head to reach committed head, transferring leadership", "committed", m.consensus.CommittedHead())
+			m.transition(ctx, StateFenced, audit.ReasonReconcile)
+			m.Step(parent)
+		}
+		return
+	}
+
+	if err := m.start(ctx, head); err != nil {
+		// There is no point in retrying against a node that is down, or that a newer leader
+		// already took over, let another node lead.
+		if rpc.IsUnavailable(err) || errors.Is(err, control.ErrStaleFencingToken) || m.retry(err) {
+			m.logger().Error("failed to start sequencer, transferring leadership", "err", err)
+			m.transition(ctx, StateFenced, audit.ReasonReconcile)
+			m.Step(parent)
+		}
+		return
+	}
+	m.transition(ctx, StateLeading, m.reason)
+}
+
+func (m *StateMachine) stepLeading(parent context.Context) {
+	if !m.shouldLead() {
+		m.transition(parent, StateSteppingDown, m.leadReason)
+		m.Step(parent)
+		return
+	}
+	ctx, cancel := m.leaderContext(parent)
+	defer cancel()
+
+	active, err := m.node.SequencerActive(ctx)
+	if err != nil {
+		if !rpc.IsUnavailable(err) {
+			m.logger().Warn("failed to get sequencer status", "err", err)
+			return
+		}
+		if m.retry(err) {
+			m.logger().Error("op-node is unavailable, transferring leadership", "err", err)
+			m.transition(ctx, StateFenced, audit.ReasonReconcile)
+			m.Step(parent)
+		}
+		return
+	}
+	m.retries = 0
+	if !active {
+		m.logger().Warn("sequencer is not active on the leader, restarting it")
+		m.metrics.RecordSequencerMismatch(metrics.MismatchInactiveOnLeader)
+		m.transition(ctx, StateBecomingLeader, audit.ReasonReconcile)
+		m.Step(parent)
+		return
+	}
+
+	if err := m.commitUnsafeHead(ctx); err != nil {
+		if errors.Is(err, fsm.ErrStaleFencingToken) {
+			m.logger().Error("a newer leader committed a head, fencing sequencer", "err", err)
+			m.transition(ctx, StateFenced, audit.ReasonReconcile)
+			m.Step(parent)
+			return
+		}
+		m.logger().Warn("failed to commit unsafe head", "err", err)
+	}
+}
+
+func (m *StateMachine) stepSteppingDown(ctx context.Context) {
+	if err := m.stop(ctx); err != nil {
+		if m.retry(err) {
+			m.transition(ctx, StateFenced, m.reason)
+		}
+		return
+	}
+
+	if m.shouldLead() {
+		m.transition(ctx, StateBecomingLeader, m.reason)
+	} else {
+		m.transition(ctx, StateFollower, m.reason)
+	}
+}
+
+func (m *StateMachine) stepFenced(ctx context.Context) {
+	if err := m.stop(ctx); err != nil {
+		m.logger().Error("failed to stop fenced sequencer", "err", err)
+		return
+	}
+
+	if m.isLeader() {
+		m.metrics.RecordLeadershipTransfer(metrics.TransferFenced)
+		err := m.consensus.TransferLeadership()
+		m.audit.Record(audit.Entry{
+			Term:   m.consensus.Term(),
+			Event:  audit.EventTransfer,
+			Reason: m.reason,
+			Params: map[string]string{"cause": metrics.TransferFenced},
+			Result: audit.Result(err),
+		})
+		if err != nil {
+			m.logger().Error("failed to transfer leadership", "err", err)
+		}
+		return
+	}
+	m.transition(ctx, StateFollower, m.reason)
+}
+
+// Shutdown stops the local batcher and sequencer regardless of the leadership status, when
+// the elector exits. Step must not be called concurrently or afterwards.
+func (m *StateMachine) Shutdown(ctx context.Context) error {
+	m.reason = audit.ReasonShutdown
+	if err := m.stop(ctx); err != nil {
+		return err
+	}
+	m.transition(ctx, StateFollower, audit.ReasonShutdown)
+	return nil
+}
+
+// start starts the sequencer on the given head with the fencing token of the term, and then
+// the batcher. Either one already running is not an error.
+func (m *StateMachine) start(ctx context.Context, head common.Hash) error {
+	err := m.node.StartSequencer(ctx, head, m.token)
+	m.record(audit.EventStartSequencer, map[string]string{"head": head.String(), "token": m.token.String()}, err)
+	if err != nil && !errors.Is(err, control.ErrSequencerAlreadyStarted) {
+		return errors.Wrap(err, "failed to start sequencer")
+	}
+	err = m.batcher.StartBatcher(ctx)
+	m.record(audit.EventStartBatcher, nil, err)
+	if err != nil && !errors.Is(err, control.ErrBatcherAlreadyStarted) {
+		return errors.Wrap(err, "failed to start batcher")
+	}
+	return nil
+}
+
+// stop stops the batcher and then the sequencer. Either one already stopped is not an error.
+func (m *StateMachine) stop(ctx context.Context) error {
+	err := m.batcher.StopBatcher(ctx)
+	m.record(audit.EventStopBatcher, nil, err)
+	if err != nil && !errors.Is(err, control.ErrBatcherAlreadyStopped) {
+		return errors.Wrap(err, "failed to stop batcher")
+	}
+	hsh, err := m.node.StopSequencer(ctx)
+	var params map[string]string
+	if err == nil {
+		params = map[string]string{"head": hsh.String()}
+	}
+	m.record(audit.EventStopSequencer, params, err)
+	if err != nil && !errors.Is(err, control.ErrSequencerAlreadyStopped) {
+		return errors.Wrap(err, "failed to stop sequencer")
+	}
+	return nil
+}
+
+// record writes a control call made for the reason of the last transition to the audit log.
+func (m *StateMachine) record(event string, params map[string]string, err error) {
+	m.audit.Record(audit.Entry{
+		Term:   m.consensus.Term(),
+		Event:  event,
+		Reason: m.reason,
+		Params: params,
+		Result: audit.Result(err),
+	})
+}
+
+// catchUp checks whether the local geth head includes the last unsafe head committed by the
+// cluster, and returns the block hash to start sequencing on. If the local head is ahead of
+// the committed one, it is committed first so the sequencer only ever starts on a committed
+// head. Nothing committed yet (e.g. on a freshly bootstrapped cluster) means the local head
+// is used. An error is returned if the local chain can never catch up. The fencing token of
+// the term is taken once all committed logs are applied.
+func (m *StateMachine) catchUp(ctx context.Context) (common.Hash, bool, error) {
+	if err := m.consensus.Barrier(); err != nil {
+		m.logger().Warn("failed to apply committed logs", "err", err)
+		return common.Hash{}, false, nil
+	}
+	if m.token.IsZero() {
+		token, err := m.consensus.FencingToken()
+		if err != nil {
+			m.logger().Warn("failed to get fencing token", "err", err)
+			return common.Hash{}, false, nil
+		}
+		m.token = token
+	}
+
+	committed := m.consensus.CommittedHead()
+	local, err := m.geth.LatestBlock(ctx)
+	if err != nil {
+		m.logger().Warn("failed to get latest block", "err", err)
+		return common.Hash{}, false, nil
+	}
+	if committed.IsZero() {
+		return local.Hash, true, nil
+	}
+	if local.Number < committed.Number {
+		m.logger().Info("waiting for local head to reach committed head", "local", local.Number, "committed", committed)
+		return common.Hash{}, false, nil
+	}
+
+	canonical, err := m.geth.BlockByNumber(ctx, committed.Number)
+	if err != nil {
+		m.logger().Warn("failed to get block", "number", committed.Number, "err", err)
+		return common.Hash{}, false, nil
+	}
+	if canonical.Hash != committed.Hash {
+		return common.Hash{}, false, fmt.Errorf("local chain diverged from committed head %s, found %s", committed.String(), canonical.Hash.String())
+	}
+	if local.Number > committed.Number {
+		if err := m.consensus.CommitHead(fsm.Head{Hash: local.Hash, Number: local.Number}, m.token); err != nil {
+			m.logger().Warn("failed to commit local head", "err", err)
+			return common.Hash{}, false, nil
+		}
+	}
+	return m.consensus.CommittedHead().Hash, true, nil
+}
+
+// commitUnsafeHead replicates the latest unsafe head produced by the local sequencer to the
+// cluster, so that the next leader continues from it.
+func (m *StateMachine) commitUnsafeHead(ctx context.Context) error {
+	latest, err := m.geth.LatestBlock(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to get latest block")
+	}
+
+	committed := m.consensus.CommittedHead()
+	if !committed.IsZero() && latest.Number <= committed.Number {
+		return nil
+	}
+	return m.consensus.CommitHead(fsm.Head{Hash: latest.Hash, Number: latest.Number}, m.token)
+}
@@ -0,0 +1,379 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/base-org/leader-election/leader/control"
+	"github.com/base-org/leader-election/leader/fsm"
+	"github.com/base-org/leader-election/leader/rpc"
+	"github.com/hashicorp/go-hclog"
+)
+
+// fakeConsensus is an in-memory Consensus of a single term.
+type fakeConsensus struct {
+	mu        sync.Mutex
+	head      fsm.Head
+	paused    bool
+	commitErr error
+	transfers int
+}
+
+var _ Consensus = (*fakeConsensus)(nil)
+
+func (c *fakeConsensus) Barrier() error { return nil }
+
+func (c *fakeConsensus) CommittedHead() fsm.Head {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.head
+}
+
+func (c *fakeConsensus) FencingToken() (rpc.FencingToken, error) {
+	return rpc.FencingToken{Term: 1, Index: 1}, nil
+}
+
+func (c *fakeConsensus) CommitHead(head fsm.Head, token rpc.FencingToken) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.commitErr != nil {
+		return c.commitErr
+	}
+	c.head = head
+	return nil
+}
+
+func (c *fakeConsensus) SequencingPaused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.paused
+}
+
+func (c *fakeConsensus) Term() uint64 { return 1 }
+
+func (c *fakeConsensus) TransferLeadership() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.transfers++
+	return nil
+}
+
+type testEnv struct {
+	consensus *fakeConsensus
+	node      *control.MockNodeRPC
+	batcher   *control.MockBatcherRPC
+	geth      *control.MockGethRPC
+	sm        *StateMachine
+}
+
+func newTestEnv(cfg StateMachineConfig) *testEnv {
+	log := hclog.NewNullLogger()
+	env := &testEnv{
+		consensus: &fakeConsensus{},
+		node:      control.NewMockNodeRPC(log).(*control.MockNodeRPC),
+		batcher:   control.NewMockBatcherRPC(log).(*control.MockBatcherRPC),
+		geth:      control.NewMockGethRPC().(*control.MockGethRPC),
+	}
+	env.sm = NewStateMachine(cfg, env.consensus, env.node, env.batcher, env.geth, log, nil, nil)
+	return env
+}
+
+func (env *testEnv) step(n int) {
+	for i := 0; i < n; i++ {
+		env.sm.Step(context.Background())
+	}
+}
+
+func (env *testEnv) sequencerActive(t *testing.T) bool {
+	t.Helper()
+	active, err := env.node.SequencerActive(context.Background())
+	if err != nil {
+		t.Fatalf("failed to get mock sequencer status: %v", err)
+	}
+	return active
+}
+
+func TestStateMachineTransitions(t *testing.T) {
+	errDown := errors.New("connection refused")
+
+	tests := []struct {
+		name string
+		cfg  StateMachineConfig
+		// setup prepares the environment, the state machine starts as a follower.
+		setup func(env *testEnv)
+		// steps is how many times Step is called after setup.
+		steps         int
+		want          State
+		wantActive    bool
+		wantTransfers int
+	}{
+		{
+			name: "follower stays follower",
+			setup: func(env *testEnv) {
+				env.sm.SetLeader(false)
+			},
+			steps: 2,
+			want:  StateFollower,
+		},
+		{
+			name: "follower becomes leader and leads",
+			setup: func(env *testEnv) {
+				env.sm.SetLeader(true)
+			},
+			steps:      1,
+			want:       StateLeading,
+			wantActive: true,
+		},
+		{
+			name: "leader waits for geth to catch up",
+			cfg:  StateMachineConfig{CatchUpTimeout: time.Hour},
+			setup: func(env *testEnv) {
+				env.consensus.head = fsm.Head{Hash: [32]byte{1}, Number: math.MaxUint64}
+				env.sm.SetLeader(true)
+			},
+			steps: 2,
+			want:  StateBecomingLeader,
+		},
+		{
+			name: "catch-up timeout fences",
+			setup: func(env *testEnv) {
+				env.consensus.head = fsm.Head{Hash: [32]byte{1}, Number: math.MaxUint64}
+				env.sm.SetLeader(true)
+			},
+			steps:         1,
+			want:          StateFenced,
+			wantTransfers: 1,
+		},
+		{
+			name: "geth unreachable while catching up does not fence before the timeout",
+			cfg:  StateMachineConfig{CatchUpTimeout: time.Hour},
+			setup: func(env *testEnv) {
+				env.geth.SetError(control.GetBlockByNumberMethod, errDown)
+				env.sm.SetLeader(true)
+			},
+			steps: 3,
+			want:  StateBecomingLeader,
+		},
+		{
+			name: "stale token on start fences",
+			cfg:  StateMachineConfig{CatchUpTimeout: time.Hour},
+			setup: func(env *testEnv) {
+				env.node.SetError(control.StartSequencerMethod, control.ErrStaleFencingToken)
+				env.sm.SetLeader(true)
+			},
+			steps:         1,
+			want:          StateFenced,
+			wantTransfers: 1,
+		},
+		{
+			name: "stale token on head commit fences",
+			cfg:  StateMachineConfig{CatchUpTimeout: time.Hour},
+			setup: func(env *testEnv) {
+				env.sm.SetLeader(true)
+				env.step(1)
+				env.consensus.commitErr = fsm.ErrStaleFencingToken
+			},
+			steps:         1,
+			want:          StateFenced,
+			wantTransfers: 1,
+		},
+		{
+			name: "batcher start failures are retried before fencing",
+			cfg:  StateMachineConfig{CatchUpTimeout: time.Hour, MaxRetries: 2},
+			setup: func(env *testEnv) {
+				env.batcher.SetError(control.StartBatcherMethod, errors.New("batcher failed"))
+				env.sm.SetLeader(true)
+			},
+			steps: 2,
+			want:  StateBecomingLeader,
+			// The sequencer is started before the batcher.
+			wantActive: true,
+		},
+		{
+			name: "batcher start failures fence once retries are exhausted",
+			cfg:  StateMachineConfig{CatchUpTimeout: time.Hour, MaxRetries: 2},
+			setup: func(env *testEnv) {
+				env.batcher.SetError(control.StartBatcherMethod, errors.New("batcher failed"))
+				env.sm.SetLeader(true)
+			},
+			steps:         3,
+			want:          StateFenced,
+			wantTransfers: 1,
+		},
+		{
+			name: "losing leadership steps down",
+			cfg:  StateMachineConfig{CatchUpTimeout: time.Hour},
+			setup: func(env *testEnv) {
+				env.sm.SetLeader(true)
+				env.step(1)
+				env.sm.SetLeader(false)
+			},
+			steps: 1,
+			want:  StateFollower,
+		},
+		{
+			name: "pausing sequencing steps down",
+			cfg:  StateMachineConfig{CatchUpTimeout: time.Hour},
+			setup: func(env *testEnv) {
+				env.sm.SetLeader(true)
+				env.step(1)
+				env.consensus.paused = true
+			},
+			steps: 1,
+			want:  StateFollower,
+		},
+		{
+			name: "stepping down retries a failed stop",
+			cfg:  StateMachineConfig{CatchUpTimeout: time.Hour, MaxRetries: 2},
+			setup: func(env *testEnv) {
+				env.sm.SetLeader(true)
+				env.step(1)
+				env.node.SetError(control.StopSequencerMethod, errDown)
+				env.sm.SetLeader(false)
+			},
+			steps:      2,
+			want:       StateSteppingDown,
+			wantActive: true,
+		},
+		{
+			name: "stepping down fences once retries are exhausted",
+			cfg:  StateMachineConfig{CatchUpTimeout: time.Hour, MaxRetries: 2},
+			setup: func(env *testEnv) {
+				env.sm.SetLeader(true)
+				env.step(1)
+				env.node.SetError(control.StopSequencerMethod, errDown)
+				env.sm.SetLeader(false)
+			},
+			steps:      4,
+			want:       StateFenced,
+			wantActive: true,
+		},
+		{
+			name: "fenced follower recovers once the sequencer stops",
+			cfg:  StateMachineConfig{CatchUpTimeout: time.Hour, MaxRetries: 2},
+			setup: func(env *testEnv) {
+				env.sm.SetLeader(true)
+				env.step(1)
+				env.node.SetError(control.StopSequencerMethod, errDown)
+				env.sm.SetLeader(false)
+				env.step(4)
+				env.node.SetError(control.StopSequencerMethod, nil)
+			},
+			steps: 1,
+			want:  StateFollower,
+		},
+		{
+			name: "sequencer active on a follower is stopped",
+			setup: func(env *testEnv) {
+				env.node.StartSequencer(context.Background(), [32]byte{}, rpc.FencingToken{})
+			},
+			steps: 1,
+			want:  StateFollower,
+		},
+		{
+			name: "sequencer stopped on the leader is restarted",
+			cfg:  StateMachineConfig{CatchUpTimeout: time.Hour},
+			setup: func(env *testEnv) {
+				env.sm.SetLeader(true)
+				env.step(1)
+				env.node.StopSequencer(context.Background())
+			},
+			steps:      1,
+			want:       StateLeading,
+			wantActive: true,
+		},
+		{
+			name: "unavailable op-node on the leader fences once retries are exhausted",
+			cfg:  StateMachineConfig{CatchUpTimeout: time.Hour, MaxRetries: 1},
+			setup: func(env *testEnv) {
+				env.sm.SetLeader(true)
+				env.step(1)
+				env.node.SetError(control.SequencerActiveMethod, &rpc.TransportError{URL: "http://op-node", Err: errDown})
+			},
+			steps:         2,
+			want:          StateFenced,
+			wantActive:    false,
+			wantTransfers: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(tt.cfg)
+			tt.setup(env)
+			env.step(tt.steps)
+
+			if got := env.sm.State(); got != tt.want {
+				t.Errorf("State() = %s, want %s", got, tt.want)
+			}
+			env.node.SetError(control.SequencerActiveMethod, nil)
+			if got := env.sequencerActive(t); got != tt.wantActive {
+				t.Errorf("sequencer active = %t, want %t", got, tt.wantActive)
+			}
+			if got := env.consensus.transfers; got != tt.wantTransfers {
+				t.Errorf("leadership transfers = %d, want %d", got, tt.wantTransfers)
+			}
+		})
+	}
+}
+
+func TestStateMachineLeadingCommitsHeads(t *testing.T) {
+	env := newTestEnv(StateMachineConfig{CatchUpTimeout: time.Hour})
+	env.sm.SetLeader(true)
+	env.step(2)
+
+	if got := env.sm.State(); got != StateLeading {
+		t.Fatalf("State() = %s, want %s", got, StateLeading)
+	}
+	latest, err := env.geth.LatestBlock(context.Background())
+	if err != nil {
+		t.Fatalf("failed to get latest block: %v", err)
+	}
+	if got := env.consensus.CommittedHead(); got.Number < latest.Number-1 || got.Hash == ([32]byte{}) {
+		t.Errorf("CommittedHead() = %v, want about %d", got, latest.Number)
+	}
+}
+
+func TestLeaderContextAfterLosingLeadership(t *testing.T) {
+	env := newTestEnv(StateMachineConfig{})
+
+	// Leadership is lost between shouldLead and leaderContext.
+	env.sm.SetLeader(false)
+	ctx, cancel := env.sm.leaderContext(context.Background())
+	cancel()
+	if ctx.Err() == nil {
+		t.Fatalf("leaderContext() is not cancelled without leadership")
+	}
+
+	env.sm.SetLeader(true)
+	ctx, cancel = env.sm.leaderContext(context.Background())
+	defer cancel()
+	if err := ctx.Err(); err != nil {
+		t.Fatalf("leaderContext() = %v in the next term, want an active context", err)
+	}
+	env.sm.SetLeader(false)
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("leaderContext() is not cancelled after losing leadership")
+	}
+}
+
+type ctxKey struct{}
+
+func TestLeaderContextKeepsCallerValues(t *testing.T) {
+	env := newTestEnv(StateMachineConfig{})
+	env.sm.SetLeader(true)
+
+	// Each step traces its calls under its own span, carried by its context.
+	for _, step := range []string{"first", "second"} {
+		ctx, cancel := env.sm.leaderContext(context.WithValue(context.Background(), ctxKey{}, step))
+		if got := ctx.Value(ctxKey{}); got != step {
+			t.Errorf("leaderContext() value = %v, want %s", got, step)
+		}
+		cancel()
+	}
+}
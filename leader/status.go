@@ -0,0 +1,166 @@
+package leader
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/base-org/leader-election/leader/fsm"
+	lh "github.com/base-org/leader-election/leader/health"
+	"github.com/pkg/errors"
+)
+
+// statusTimeout bounds the op-node call made to serve a status request.
+const statusTimeout = 1 * time.Second
+
+// Status is the view of the cluster from the local node, served as JSON on /status.
+type Status struct {
+	ID      string `json:"id"`
+	Address string `json:"address"`
+	// RaftState is follower, candidate, leader or shutdown.
+	RaftState    string         `json:"raftState"`
+	Leader       ServerStatus   `json:"leader"`
+	Term         uint64         `json:"term"`
+	CommitIndex  uint64         `json:"commitIndex"`
+	AppliedIndex uint64         `json:"appliedIndex"`
+	Servers      []ServerStatus `json:"servers"`
+	// State is the state of the local sequencer state machine.
+	State string `json:"state"`
+	// SequencerActive is reported by the local op-node, it is null if it could not be
+	// queried and SequencerError holds why.
+	SequencerActive  *bool  `json:"sequencerActive"`
+	SequencerError   string `json:"sequencerError,omitempty"`
+	SequencingPaused bool   `json:"sequencingPaused"`
+	// Health is the last local health report, null until the first one.
+	Health *lh.HealthReport `json:"health"`
+	// UnsafeHead is the last unsafe head committed by the cluster.
+	UnsafeHead fsm.Head `json:"unsafeHead"`
+}
+
+// ServerStatus is a member of the raft cluster.
+type ServerStatus struct {
+	ID      string `json:"id"`
+	Address string `json:"address"`
+	// Suffrage is voter, nonvoter or staging, empty for the leader field of Status.
+	Suffrage string `json:"suffrage,omitempty"`
+}
+
+// Status returns the view of the cluster from the local node.
+func (e *Elector) Status(ctx context.Context) Status {
+	stats := e.raft.Stats()
+	leaderAddr, leaderID := e.raft.LeaderWithID()
+	s := Status{
+		ID:               string(e.config.RaftConfig.LocalID),
+		Address:          e.config.ServerAddr,
+		RaftState:        strings.ToLower(e.raft.State().String()),
+		Leader:           ServerStatus{ID: string(leaderID), Address: string(leaderAddr)},
+		AppliedIndex:     e.raft.AppliedIndex(),
+		State:            e.sm.State().String(),
+		SequencingPaused: e.consensus.SequencingPaused(),
+		Health:           e.lastHealth(),
+		UnsafeHead:       e.consensus.CommittedHead(),
+	}
+	s.Term, _ = strconv.ParseUint(stats["term"], 10, 64)
+	s.CommitIndex, _ = strconv.ParseUint(stats["commit_index"], 10, 64)
+
+	future := e.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		e.log.Warn("failed to get raft configuration", "err", err)
+	} else {
+		for _, srv := range future.Configuration().Servers {
+			s.Servers = append(s.Servers, ServerStatus{
+				ID:       string(srv.ID),
+				Address:  string(srv.Address),
+				Suffrage: strings.ToLower(srv.Suffrage.String()),
+			})
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, statusTimeout)
+	defer cancel()
+	if active, err := e.nodeRPC.SequencerActive(ctx); err != nil {
+		s.SequencerError = err.Error()
+	} else {
+		s.SequencerActive = &active
+	}
+	return s
+}
+
+// Ready returns nil if the node can take part in the cluster: raft knows a leader and the
+// last local health report is healthy.
+func (e *Elector) Ready() error {
+	if addr, _ := e.raft.LeaderWithID(); addr == "" {
+		return errors.New("no leader elected")
+	}
+	report := e.lastHealth()
+	if report == nil {
+		return errors.New("no health report yet")
+	}
+	if !report.Healthy {
+		return errors.Errorf("unhealthy: %s", strings.Join(report.Unhealthy(), ", "))
+	}
+	return nil
+}
+
+// lastHealth returns the last local health report, or nil until the first one.
+func (e *Elector) lastHealth() *lh.HealthReport {
+	e.healthMu.RLock()
+	defer e.healthMu.RUnlock()
+	return e.health
+}
+
+func (e *Elector) setLastHealth(report lh.HealthReport) {
+	e.healthMu.Lock()
+	defer e.healthMu.Unlock()
+	e.health = &report
+}
+
+// serveStatus serves the status API on addr until ctx is cancelled:
+//   - /status returns the Status as JSON,
+//   - /leader returns 200 if the node is the leader and its lease holds, 503 otherwise,
+//   - /ready returns 200 if the node is Ready, 503 otherwise.
+func (e *Elector) serveStatus(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(e.Status(r.Context())); err != nil {
+			e.log.Debug("failed to write status", "err", err)
+		}
+	})
+	mux.HandleFunc("/leader", func(w http.ResponseWriter, r *http.Request) {
+		if !e.leader.Load() {
+			http.Error(w, "not leader", http.StatusServiceUnavailable)
+			return
+		}
+		if e.leaseExpired.Load() {
+			http.Error(w, "leader lease expired", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
+		if err := e.Ready(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok\n"))
+	})
+	srv := &http.Server{Handler: mux}
+
+	sock, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errors.Wrap(err, "failed to listen for status")
+	}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	if err := srv.Serve(sock); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return errors.Wrap(err, "failed to serve status")
+	}
+	return nil
+}
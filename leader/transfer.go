@@ -0,0 +1,49 @@
+package leader
+
+import (
+	"time"
+
+	"github.com/base-org/leader-election/leader/cluster"
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+)
+
+// ErrNoHealthyPeer is returned when peers reported their health but none can take over.
+var ErrNoHealthyPeer = errors.New("no healthy peer to transfer leadership to")
+
+// transferTarget picks the voter to hand leadership to: among the peers that recently
+// reported they can sequence, the one with the highest op-geth head. It returns false and no
+// error if no peer reported recently, leaving the choice to raft, and ErrNoHealthyPeer if
+// peers reported but none of them can sequence.
+func transferTarget(servers []raft.Server, self raft.ServerID, peers *cluster.Registry, maxAge time.Duration) (raft.Server, bool, error) {
+	var (
+		best     raft.Server
+		bestHead uint64
+		found    bool
+		reported bool
+	)
+	for _, srv := range servers {
+		if srv.ID == self || srv.Suffrage != raft.Voter {
+			continue
+		}
+		status, ok := peers.Get(string(srv.ID), maxAge)
+		if !ok {
+			continue
+		}
+		reported = true
+		if !status.Report.CanSequence() {
+			continue
+		}
+		if !found || status.Head.Number > bestHead {
+			best, bestHead, found = srv, status.Head.Number, true
+		}
+	}
+
+	if found {
+		return best, true, nil
+	}
+	if reported {
+		return raft.Server{}, false, ErrNoHealthyPeer
+	}
+	return raft.Server{}, false, nil
+}
@@ -0,0 +1,89 @@
+package leader
+
+import (
+	"testing"
+	"time"
+
+	"github.com/base-org/leader-election/leader/cluster"
+	lh "github.com/base-org/leader-election/leader/health"
+	"github.com/base-org/leader-election/leader/rpc"
+	"github.com/hashicorp/raft"
+)
+
+func TestTransferTarget(t *testing.T) {
+	healthy := lh.HealthReport{Healthy: true, Components: []lh.ComponentStatus{{Name: lh.ComponentNode, Healthy: true}}}
+	batcherDown := lh.HealthReport{Components: []lh.ComponentStatus{{Name: lh.ComponentBatcher}}}
+	nodeDown := lh.HealthReport{Components: []lh.ComponentStatus{{Name: lh.ComponentNode}}}
+
+	servers := []raft.Server{
+		{ID: "self", Suffrage: raft.Voter},
+		{ID: "a", Suffrage: raft.Voter},
+		{ID: "b", Suffrage: raft.Voter},
+		{ID: "c", Suffrage: raft.Nonvoter},
+	}
+
+	tests := []struct {
+		name    string
+		reports map[string]lh.HealthReport
+		heads   map[string]uint64
+		want    raft.ServerID
+		wantOK  bool
+		wantErr error
+	}{
+		{
+			name: "no reports leaves the choice to raft",
+		},
+		{
+			name:    "most caught up healthy voter",
+			reports: map[string]lh.HealthReport{"a": healthy, "b": healthy},
+			heads:   map[string]uint64{"a": 10, "b": 12},
+			want:    "b",
+			wantOK:  true,
+		},
+		{
+			name:    "unhealthy voter is skipped even when ahead",
+			reports: map[string]lh.HealthReport{"a": healthy, "b": nodeDown},
+			heads:   map[string]uint64{"a": 10, "b": 12},
+			want:    "a",
+			wantOK:  true,
+		},
+		{
+			name:    "a failing batcher alone does not disqualify",
+			reports: map[string]lh.HealthReport{"a": batcherDown},
+			want:    "a",
+			wantOK:  true,
+		},
+		{
+			name:    "non-voters and self are never picked",
+			reports: map[string]lh.HealthReport{"self": healthy, "c": healthy, "a": nodeDown},
+			wantErr: ErrNoHealthyPeer,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			peers := cluster.NewRegistry()
+			for id, report := range tt.reports {
+				peers.Update(cluster.PeerStatus{ID: id, Report: report, Head: rpc.BlockID{Number: tt.heads[id]}})
+			}
+
+			got, ok, err := transferTarget(servers, "self", peers, time.Minute)
+			if err != tt.wantErr {
+				t.Fatalf("transferTarget() error = %v, want %v", err, tt.wantErr)
+			}
+			if ok != tt.wantOK || got.ID != tt.want {
+				t.Fatalf("transferTarget() = %q, %t, want %q, %t", got.ID, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestTransferTargetIgnoresStaleReports(t *testing.T) {
+	peers := cluster.NewRegistry()
+	peers.Update(cluster.PeerStatus{ID: "a"})
+
+	servers := []raft.Server{{ID: "self", Suffrage: raft.Voter}, {ID: "a", Suffrage: raft.Voter}}
+	_, ok, err := transferTarget(servers, "self", peers, -time.Second)
+	if ok || err != nil {
+		t.Fatalf("transferTarget() = %t, %v, want false, nil", ok, err)
+	}
+}
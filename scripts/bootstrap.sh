@@ -22,7 +22,6 @@ awk '!found && /BOOTSTRAP=true/ {sub(/BOOTSTRAP=true/, "BOOTSTRAP=false"); found
 
 sleep 5
 # Add other participants
-raftadmin localhost:50051 add_voter NodeB elector2:50052 0
-# most likely the leader will remain the same, otherwise we should use
-# >> raftadmin localhost:50052 add_voter NodeC elector3:50053 0
-raftadmin localhost:50051 add_voter NodeC elector3:50053 0
+# membership changes are forwarded to the current leader
+docker-compose exec elector1 ./leader_elector add-voter --addr elector1:50051 NodeB elector2:50052
+docker-compose exec elector1 ./leader_elector add-voter --addr elector1:50051 NodeC elector3:50053
@@ -1,23 +1,12 @@
 #!/bin/sh
 
-sequencer_active() {
-    curl -s \
-        --location http://node:8545 \
-        --header 'Content-Type: application/json' \
-        --data '{
-        "jsonrpc":"2.0",
-        "method":"admin_sequencerActive",
-        "params":[
-        ],
-        "id":1
-    }' |
-        jq -r .result
-}
+# Address of the elector status API, see --status-addr. docker-compose.yml publishes it on
+# localhost:7400, 7401 and 7402 for elector1, elector2 and elector3.
+STATUS_ADDR=${STATUS_ADDR:-localhost:7400}
 
-raft_leader() {
-    raftadmin localhost:50050 leader
+status() {
+    curl -s "http://$STATUS_ADDR/status"
 }
 
 echo "Node status:"
-echo "sequencer active: $(sequencer_active)"
-echo "raft leader: $(raft_leader)"
+status | jq '{id, raftState, leader, term, state, sequencerActive, sequencingPaused, unsafeHead}'